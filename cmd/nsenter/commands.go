@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// execute runs the command line args, without the program name, and
+// returns the exit status. A command line that does not name a subcommand
+// after the leading root flags is taken as one for enter, so
+// nsenter --target 1 --net sh still does what it always did; see
+// legacyArgs.
+func execute(args []string) int {
+	exitCode := 0
+	root := newRootCommand(&exitCode)
+	root.SetArgs(legacyArgs(root, args))
+	if err := root.Execute(); err != nil {
+		logger.Error(err.Error())
+		return 1
+	}
+	return exitCode
+}
+
+// legacyArgs rewrites a command line of the form nsenter has always taken
+// for the command tree. Unless a subcommand follows the leading root
+// flags, enter is inserted there. Its long flags given with a single dash,
+// as the flag package it was written for accepted, get a second one.
+func legacyArgs(root *cobra.Command, args []string) []string {
+	args = slices.Clone(args)
+	i := fixFlags(root.PersistentFlags(), args)
+	if i < len(args) && isSubcommand(root, args[i]) && args[i] != "enter" {
+		return args
+	}
+	if i == len(args) || args[i] != "enter" {
+		args = slices.Insert(args, i, "enter")
+	}
+	enter, _, _ := root.Find([]string{"enter"})
+	fixFlags(enter.Flags(), args[i+1:])
+	return args
+}
+
+// fixFlags doubles the dash of single-dash long flags of flags at the start
+// of args, and returns the index of the first argument that is neither one
+// of them nor a flag's value.
+func fixFlags(flags *pflag.FlagSet, args []string) int {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return i
+		}
+		name, _, inline := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		f := flags.Lookup(name)
+		if f == nil {
+			return i
+		}
+		if !strings.HasPrefix(arg, "--") {
+			args[i] = "-" + arg
+		}
+		if !inline && f.NoOptDefVal == "" {
+			i++
+		}
+	}
+	return len(args)
+}
+
+// isSubcommand reports whether arg names a subcommand of root, including
+// cobra's hidden completion ones, or asks for root's help.
+func isSubcommand(root *cobra.Command, arg string) bool {
+	switch arg {
+	case "help", "-h", "--help", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return true
+	}
+	for _, c := range root.Commands() {
+		if c.Name() == arg || slices.Contains(c.Aliases, arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRootCommand builds the command tree. enter stores its exit status in
+// exitCode; the other subcommands report failure by returning an error.
+func newRootCommand(exitCode *int) *cobra.Command {
+	var (
+		target  int
+		verbose bool
+	)
+	root := &cobra.Command{
+		Use:   filepath.Base(os.Args[0]),
+		Short: "Run programs in the namespaces of other processes",
+		Long: "Run programs in the namespaces of other processes.\n\n" +
+			"Without a subcommand, the arguments are those of enter.",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if verbose {
+				logLevel.Set(slog.LevelDebug)
+			}
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	target = -1
+	root.PersistentFlags().Var((*targetFlag)(&target), "target", "Target process PID, or a /proc/PID path; defaults to $NSENTER_TARGET_PID")
+	root.PersistentFlags().BoolVar(&verbose, "verbose", false, "Log every file opened and syscall made to stderr")
+	root.RegisterFlagCompletionFunc("target", completeTargets)
+
+	// targetPid returns the PID given as args[i], else --target, else the
+	// one from the environment.
+	targetPid := func(args []string, i int) (int, error) {
+		if i < len(args) {
+			return ns.ParseTarget(args[i])
+		}
+		if target > 0 {
+			return target, nil
+		}
+		if pid, ok := ns.ResolvePidFromEnv(); ok {
+			return pid, nil
+		}
+		return 0, errors.New("no target: give a PID or --target")
+	}
+
+	enter := newEnterCommand(exitCode)
+	// Its --help flag is defined on first use otherwise, too late for
+	// legacyArgs to know it.
+	enter.InitDefaultHelpFlag()
+
+	var listJSON bool
+	list := &cobra.Command{
+		Use:               "list [PID]",
+		Short:             "List the namespaces of a process",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeTargets,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pid, err := targetPid(args, 0)
+			if err != nil {
+				return err
+			}
+			return listNamespaces(pid, listJSON)
+		},
+	}
+	list.Flags().BoolVar(&listJSON, "json", false, "Print JSON instead of a table")
+
+	diff := &cobra.Command{
+		Use:               "diff [PID1] PID2",
+		Short:             "Show which namespaces two processes share",
+		Long:              "Show which namespaces two processes share. With a single PID, it is compared with --target.",
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeTargets,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				args = append([]string{""}, args...)
+				if target > 0 {
+					args[0] = strconv.Itoa(target)
+				} else if pid, ok := ns.ResolvePidFromEnv(); ok {
+					args[0] = strconv.Itoa(pid)
+				} else {
+					return errors.New("no target: give two PIDs or --target")
+				}
+			}
+			pid1, err := targetPid(args, 0)
+			if err != nil {
+				return err
+			}
+			pid2, err := targetPid(args, 1)
+			if err != nil {
+				return err
+			}
+			return printDiff(pid1, pid2)
+		},
+	}
+
+	pin := &cobra.Command{
+		Use:   "pin PATH...",
+		Short: "Bind-mount namespaces of --target so they outlive it",
+		Long:  "Bind-mount namespaces of --target so they outlive it. The type of each is the base name of PATH unless given as TYPE:PATH.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pid, err := targetPid(nil, 0)
+			if err != nil {
+				return err
+			}
+			for _, arg := range args {
+				nsType, path, err := parsePin(arg)
+				if err != nil {
+					return err
+				}
+				if err := ns.PinNamespace(pid, nsType, path); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	unpin := &cobra.Command{
+		Use:   "unpin PATH...",
+		Short: "Remove namespace pins",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, path := range args {
+				if err := ns.UnpinNamespace(path); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	inspect := &cobra.Command{
+		Use:               "inspect [PID]",
+		Short:             "Show the namespaces of a process in detail, as JSON",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeTargets,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pid, err := targetPid(args, 0)
+			if err != nil {
+				return err
+			}
+			return inspectProcess(pid)
+		},
+	}
+
+	root.AddCommand(enter, list, diff, pin, unpin, inspect)
+	// Added now rather than by Execute, so isSubcommand sees it.
+	root.InitDefaultCompletionCmd()
+	return root
+}
+
+// inspection is what inspect prints about a process.
+type inspection struct {
+	Pid        int         `json:"pid"`
+	Namespaces []ns.NsInfo `json:"namespaces"`
+	// NSpid is the process's PID in each pid namespace it is in, from the
+	// outermost to its own.
+	NSpid       []int          `json:"nspid,omitempty"`
+	UidMap      []ns.IdMapping `json:"uid_map,omitempty"`
+	GidMap      []ns.IdMapping `json:"gid_map,omitempty"`
+	UserNsOwner *int           `json:"user_ns_owner,omitempty"`
+}
+
+// inspectProcess prints the namespaces of pid with what can be read about
+// them. Only the namespace list is required; details that cannot be read,
+// usually for want of privilege, are left out.
+func inspectProcess(pid int) error {
+	infos, err := ns.ListNamespaces(pid)
+	if err != nil {
+		return err
+	}
+	in := inspection{Pid: pid, Namespaces: infos}
+	if st, err := ns.ParseProcStatus(pid); err == nil {
+		in.NSpid = st.NSpid
+	}
+	in.UidMap, _ = ns.ReadUidMap(pid)
+	in.GidMap, _ = ns.ReadGidMap(pid)
+	if owner, err := ns.ReadUserNsOwner(pid); err == nil {
+		in.UserNsOwner = &owner
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(in)
+}
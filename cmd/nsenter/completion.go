@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// pidFlags take PIDs and are completed with the running processes, as are
+// the per-type --TYPE-target flags.
+var pidFlags = []string{"target", "compare"}
+
+// writeCompletion writes the completion script for shell to w, for
+// --generate-completion; it is the one the completion subcommand prints.
+// The scripts call back into nsenter for candidates, so PIDs and
+// containers are always those of the running system.
+func writeCompletion(root *cobra.Command, w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		return root.GenBashCompletionV2(w, true)
+	case "zsh":
+		return root.GenZshCompletion(w)
+	case "fish":
+		return root.GenFishCompletion(w, true)
+	}
+	return fmt.Errorf("unknown shell %q (want bash, zsh or fish)", shell)
+}
+
+// completeTargets completes a PID with the running processes, described by
+// their command names.
+func completeTargets(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var pids []string
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+		if err != nil {
+			continue
+		}
+		pids = append(pids, fmt.Sprintf("%d\t%s", pid, strings.TrimSpace(string(comm))))
+	}
+	return pids, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeContainers completes a container with the running ones of the
+// detected runtime. Errors are swallowed: a completion has nowhere to
+// report them.
+func completeContainers(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	resolver, err := ns.AutoDetectRuntime()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var out []byte
+	switch r := resolver.(type) {
+	case ns.DockerResolver:
+		out, _ = exec.Command("docker", "ps", "--format", "{{.ID}}\t{{.Names}}").Output()
+	case ns.CrioResolver:
+		out, _ = exec.Command("crictl", "ps", "--quiet").Output()
+	case ns.ContainerdResolver:
+		var args []string
+		if r.Namespace != "" {
+			args = append(args, "--namespace", r.Namespace)
+		}
+		table, _ := exec.Command("ctr", append(args, "task", "ls")...).Output()
+		// Only running tasks resolve; see ContainerdResolver.ResolvePID.
+		var ids []string
+		for _, line := range strings.Split(string(table), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 3 && fields[2] == "RUNNING" {
+				ids = append(ids, fields[0])
+			}
+		}
+		out = []byte(strings.Join(ids, "\n"))
+	}
+	var containers []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			containers = append(containers, line)
+		}
+	}
+	return containers, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,882 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// osExit ends the process. Tests replace it to run main's error paths
+// without exiting.
+var osExit = os.Exit
+
+// logLevel is raised to debug by --verbose.
+var logLevel = new(slog.LevelVar)
+
+// logger reports errors on stderr, and with --verbose every namespace step.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+	Level: logLevel,
+	ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		// Timestamps only clutter one-shot CLI output.
+		if len(groups) == 0 && a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	},
+}))
+
+// nsFlagOrder lists the namespace types that have --TYPE flags.
+var nsFlagOrder = []string{"user", "mnt", "uts", "net", "ipc", "pid", "cgroup", "time"}
+
+func main() {
+	exitCode := 0
+	if os.Getenv(mountProcEnv) == "1" {
+		exitCode = runMountProcHelper()
+	} else {
+		exitCode = execute(os.Args[1:])
+	}
+	osExit(exitCode)
+}
+
+// enterFlags holds the values of enter's flags.
+type enterFlags struct {
+	pid              int
+	container        string
+	pidFile          string
+	containerRuntime string
+	// nsFlags are the --TYPE flags and nsTargets the --TYPE-target ones,
+	// by namespace type.
+	nsFlags            map[string]*bool
+	nsTargets          map[string]*int
+	allNs              bool
+	exceptNs           []string
+	waitTimeout        time.Duration
+	timeout            time.Duration
+	preserveEnv        bool
+	setEnv             []string
+	unsetEnv           []string
+	uid                int
+	gid                int
+	ambientCaps        []uint
+	preserveCreds      bool
+	username           string
+	execPath           string
+	chroot             string
+	remountSys         bool
+	pivotRoot          string
+	wd                 string
+	targetWd           bool
+	preflight          bool
+	uidMaps            []ns.UidMapping
+	gidMaps            []ns.UidMapping
+	seccompProfile     string
+	noNewPrivs         bool
+	skipIfSame         bool
+	mountProc          bool
+	unshareNs          []string
+	dryRun             bool
+	metricsAddr        string
+	auditLog           string
+	verbose            bool
+	setsid             bool
+	noFork             bool
+	setpgid            bool
+	usePTY             bool
+	listNs             bool
+	listNsJSON         bool
+	mountInfo          bool
+	groupByNs          string
+	diff               bool
+	comparePid         int
+	dumpTree           bool
+	nsPaths            map[string]string
+	pins               map[string]string
+	unpins             []string
+	profileName        string
+	saveProfile        string
+	profilesFile       string
+	showVersion        bool
+	generateCompletion string
+}
+
+// errUsage is returned by the steps of enter for a command line that is
+// missing something, to print the usage rather than an error.
+var errUsage = errors.New("usage")
+
+// newEnterCommand returns the enter subcommand, nsenter's original command
+// line, which stores its exit status in exitCode.
+func newEnterCommand(exitCode *int) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "enter [flags] [command [args...]]",
+		Short: "Run a command in the target's namespaces (the default)",
+		Args:  cobra.ArbitraryArgs,
+	}
+	f := &enterFlags{pid: -1, nsTargets: map[string]*int{}, nsPaths: map[string]string{}, pins: map[string]string{}}
+	flags := cmd.Flags()
+	// Everything from the command on is its own.
+	flags.SetInterspersed(false)
+	flags.Var((*targetFlag)(&f.pid), "target", "Target process `PID`, or a /proc/PID path such as /proc/PID/ns/net; defaults to --pid-file's, then $NSENTER_TARGET_PID")
+	flags.StringVar(&f.container, "container", "", "Container name or ID to use as the target, instead of --target or --pid-file")
+	flags.StringVar(&f.pidFile, "pid-file", "", "Read the target PID from this file")
+	flags.StringVar(&f.containerRuntime, "container-runtime", "auto", "Runtime that owns --container: docker, containerd, crio or auto to pick by socket")
+	f.nsFlags = map[string]*bool{
+		"user":   flags.Bool("user", false, "Enter user namespace (requires CAP_SYS_ADMIN in it or owning it)"),
+		"mnt":    flags.Bool("mnt", false, "Enter mount namespace"),
+		"uts":    flags.Bool("uts", false, "Enter UTS namespace"),
+		"net":    flags.Bool("net", false, "Enter network namespace"),
+		"ipc":    flags.Bool("ipc", false, "Enter IPC namespace"),
+		"pid":    flags.Bool("pid", false, "Enter PID namespace"),
+		"cgroup": flags.Bool("cgroup", false, "Enter cgroup namespace"),
+		"time":   flags.Bool("time", false, "Enter time namespace"),
+	}
+	for _, nsType := range nsFlagOrder {
+		f.nsTargets[nsType] = newTargetFlag(flags, nsType+"-target", "Enter the "+nsType+" namespace of this `PID` instead of --target's")
+	}
+	flags.BoolVar(&f.allNs, "all-ns", false, "Enter every namespace of the target that differs from nsenter's own")
+	flags.Func("except", "With --all-ns, leave out these comma-separated namespace `types`", func(v string) error {
+		f.exceptNs = strings.Split(v, ",")
+		return nil
+	})
+	flags.DurationVar(&f.waitTimeout, "wait-timeout", 0, "Wait up to this long for the target's /proc entries to appear, for a target that is only just starting")
+	flags.DurationVar(&f.timeout, "timeout", 0, "Stop the command after this long (exit status 124)")
+	flags.BoolVar(&f.preserveEnv, "preserve-env", true, "Pass nsenter's environment to the command; =false starts from an empty one")
+	flags.Func("env", "Set `KEY=VALUE` for the command (repeatable)", func(v string) error {
+		if !strings.Contains(v, "=") {
+			return fmt.Errorf("want KEY=VALUE, got %q", v)
+		}
+		f.setEnv = append(f.setEnv, v)
+		return nil
+	})
+	flags.Func("unset-env", "Remove `VAR` from the command's environment (repeatable)", func(v string) error {
+		f.unsetEnv = append(f.unsetEnv, v)
+		return nil
+	})
+	flags.IntVar(&f.uid, "uid", -1, "Run the command as this `UID`")
+	flags.IntVar(&f.gid, "gid", -1, "Run the command with this `GID`")
+	flags.Func("ambient-cap", "Raise these comma-separated `capabilities`, such as CAP_NET_RAW, in the command's ambient set, so it keeps them as a non-root --uid", func(v string) error {
+		for _, name := range strings.Split(v, ",") {
+			c, err := ns.ParseCapability(name)
+			if err != nil {
+				return err
+			}
+			f.ambientCaps = append(f.ambientCaps, c)
+		}
+		return nil
+	})
+	flags.BoolVar(&f.preserveCreds, "preserve-credentials", false, "Keep nsenter's effective capabilities across entering the namespaces and switching user")
+	flags.StringVar(&f.username, "username", "", "Run the command as this user from /etc/passwd, read in the target's mount namespace with --mnt")
+	flags.StringVar(&f.execPath, "exec-path", "", "Run the executable at `path`, or with proc-exe the target's own executable, passing all arguments to it")
+	flags.StringVar(&f.chroot, "chroot", "", "Change the command's root to this directory of the entered mount namespace")
+	flags.BoolVar(&f.remountSys, "remount-sys", false, "Mount a fresh /sys and /sys/fs/cgroup for the entered network and cgroup namespaces, in a private copy of the mount namespace")
+	flags.StringVar(&f.pivotRoot, "pivot-root", "", "Make this directory of the entered mount namespace the command's root with pivot_root, in a private copy of that namespace")
+	flags.StringVar(&f.wd, "wd", "", "Run the command in this directory of the entered mount namespace")
+	flags.BoolVar(&f.targetWd, "target-wd", false, "Run the command in the target's working directory")
+	flags.BoolVar(&f.preflight, "preflight", false, "Check for required capabilities before entering namespaces")
+	flags.Func("uid-map", "With --user, write `container:host:size` to the target's uid_map (repeatable)", func(v string) error {
+		m, err := ns.ParseIdMapping(v)
+		f.uidMaps = append(f.uidMaps, m)
+		return err
+	})
+	flags.Func("gid-map", "With --user, write `container:host:size` to the target's gid_map (repeatable)", func(v string) error {
+		m, err := ns.ParseIdMapping(v)
+		f.gidMaps = append(f.gidMaps, m)
+		return err
+	})
+	flags.StringVar(&f.seccompProfile, "seccomp-profile", "", "Confine the command with the OCI seccomp profile at this path")
+	flags.BoolVar(&f.noNewPrivs, "no-new-privs", false, "Keep the command from gaining privileges through setuid binaries")
+	flags.BoolVar(&f.skipIfSame, "skip-if-same", false, "Do not enter namespaces nsenter is already in")
+	flags.BoolVar(&f.skipIfSame, "same-ns-skip", false, "Same as --skip-if-same")
+	flags.BoolVar(&f.mountProc, "mount-proc", false, "With --pid and --mnt, give the command a /proc for the target pid namespace")
+	flags.Func("unshare", "Run the command in new namespaces of these comma-separated `types` instead of a target's", func(v string) error {
+		f.unshareNs = strings.Split(v, ",")
+		return nil
+	})
+	flags.BoolVar(&f.dryRun, "dry-run", false, "Print the syscalls that would be made, after checking the namespace files and command exist, and exit")
+	flags.StringVar(&f.metricsAddr, "metrics-addr", "", "Serve Prometheus metrics at http://`addr`/metrics while the command runs; only a forked command (--pid, --timeout) keeps nsenter around")
+	flags.StringVar(&f.auditLog, "audit-log", "", "Append a JSON line for every namespace transition to the file at `path`")
+	flags.BoolVar(&f.verbose, "verbose", false, "Log every file opened and syscall made to stderr")
+	flags.BoolVar(&f.setsid, "setsid", false, "Fork the command as the leader of a new session, with its stdin as controlling terminal, for job control; implied by --pty")
+	flags.BoolVar(&f.noFork, "no-fork", false, "Exec the command in place even with --pid; it then stays in nsenter's pid namespace, with outer PIDs, and only its children join the target's")
+	flags.BoolVar(&f.setpgid, "setpgid", false, "Make the command a process group leader; a forked command always is one")
+	flags.BoolVar(&f.usePTY, "pty", false, "Run the command on a new pseudo-terminal")
+	flags.BoolVar(&f.listNs, "list-ns", false, "List the target's namespaces and exit")
+	flags.BoolVar(&f.listNsJSON, "list-ns-json", false, "List the target's namespaces as JSON and exit")
+	flags.BoolVar(&f.mountInfo, "mount-info", false, "Print the mount table of the target's mount namespace (or --mnt-target's) as JSON and exit")
+	flags.StringVar(&f.groupByNs, "group-by-ns", "", "List all processes grouped by their namespace of `type`, such as net, and exit")
+	flags.BoolVar(&f.diff, "diff", false, "Print which namespaces of --target and --compare are shared and exit")
+	flags.IntVar(&f.comparePid, "compare", -1, "With --diff, the `PID` to compare --target with")
+	flags.BoolVar(&f.dumpTree, "dump-tree", false, "Print the process tree under the target (default 1) with namespaces as JSON and exit")
+	flags.Func("ns-path", "Enter the namespace pinned at `type:path` (repeatable)", func(v string) error {
+		nsType, path, ok := strings.Cut(v, ":")
+		if !ok || nsType == "" || path == "" {
+			return fmt.Errorf("want type:path, got %q", v)
+		}
+		f.nsPaths[nsType] = path
+		return nil
+	})
+	flags.Func("pin", "Bind-mount the target's namespace to `path` and exit; the type is the base name of path unless given as type:path (repeatable)", func(v string) error {
+		nsType, path, err := parsePin(v)
+		f.pins[path] = nsType
+		return err
+	})
+	flags.Func("unpin", "Remove the namespace pin at `path` and exit (repeatable)", func(v string) error {
+		f.unpins = append(f.unpins, v)
+		return nil
+	})
+	flags.Func("netns", "Enter the ip netns network namespace `name`; same as --ns-path=net:/var/run/netns/NAME", func(v string) error {
+		f.nsPaths["net"] = ns.NamedNetNsPath(v)
+		return nil
+	})
+	flags.StringVar(&f.profileName, "profile", "", "Take defaults for the target, namespaces, command and environment from the profile `name`; flags given override them")
+	flags.StringVar(&f.saveProfile, "save-profile", "", "Save the target, namespaces, command and --env values given as the profile `name` and exit")
+	flags.StringVar(&f.profilesFile, "profiles", "", "Profiles file for --profile and --save-profile (default ~/.config/nsenter/profiles.yaml)")
+	flags.BoolVar(&f.showVersion, "version", false, "Print the version and exit")
+	flags.StringVar(&f.generateCompletion, "generate-completion", "", "Print the completion script for `shell` (bash, zsh or fish) and exit")
+
+	for _, name := range pidFlags {
+		cmd.RegisterFlagCompletionFunc(name, completeTargets)
+	}
+	for _, nsType := range nsFlagOrder {
+		cmd.RegisterFlagCompletionFunc(nsType+"-target", completeTargets)
+	}
+	cmd.RegisterFlagCompletionFunc("container", completeContainers)
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		*exitCode = runEnter(cmd, f, args)
+	}
+	return cmd
+}
+
+// runEnter runs enter with the flags f and the positional arguments, and
+// returns the exit status: that of the command, or 1 if nsenter fails.
+func runEnter(cmd *cobra.Command, f *enterFlags, positional []string) int {
+	code, err := enter(cmd, f, positional)
+	if errors.Is(err, errUsage) {
+		cmd.Usage()
+	} else if err != nil {
+		logger.Error(err.Error())
+	}
+	return code
+}
+
+// enter does the work of runEnter, in the order the flags take effect:
+// the modes that print something and exit, then the command's.
+func enter(cmd *cobra.Command, f *enterFlags, positional []string) (int, error) {
+	if f.showVersion {
+		fmt.Println(versionLine())
+		return 0, nil
+	}
+	if f.generateCompletion != "" {
+		return exitStatus(writeCompletion(cmd.Root(), os.Stdout, f.generateCompletion))
+	}
+
+	profileCommand, err := f.applyProfile(cmd.Flags())
+	if err != nil {
+		return 1, err
+	}
+	if err := f.resolveTarget(cmd.Flags()); err != nil {
+		return 1, err
+	}
+	if done, err := f.runAction(); done {
+		return exitStatus(err)
+	}
+
+	argv := positional
+	if len(argv) == 0 {
+		argv = profileCommand
+	}
+	if f.saveProfile != "" {
+		return exitStatus(f.writeProfile(argv))
+	}
+	command, args, err := f.commandLine(argv, positional)
+	if err != nil {
+		return 1, err
+	}
+	if err := f.validateFlags(command); err != nil {
+		return 1, err
+	}
+	if f.mountProc {
+		command, args = mountProcCommand(command, args)
+		f.setEnv = append(f.setEnv, mountProcEnv+"=1")
+	}
+
+	config, err := f.buildConfig(command, args)
+	if err != nil {
+		return 1, err
+	}
+	if config.AuditLog != nil {
+		// Left open across exec in the no-fork path; O_CLOEXEC closes it.
+		defer config.AuditLog.Close()
+	}
+	return f.start(config)
+}
+
+// exitStatus is the exit status, 0 or 1, for a mode that ends with err.
+func exitStatus(err error) (int, error) {
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// applyProfile fills in the flags not given from --profile, if any, and
+// returns the profile's command.
+func (f *enterFlags) applyProfile(flags *pflag.FlagSet) ([]string, error) {
+	if f.profilesFile == "" && (f.profileName != "" || f.saveProfile != "") {
+		path, err := ns.DefaultProfilesPath()
+		if err != nil {
+			return nil, err
+		}
+		f.profilesFile = path
+	}
+	if f.profileName == "" {
+		return nil, nil
+	}
+	profiles, err := ns.LoadProfiles(f.profilesFile)
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := profiles[f.profileName]
+	if !ok {
+		return nil, fmt.Errorf("no such profile %q in %s", f.profileName, f.profilesFile)
+	}
+	if !flags.Changed("target") && !flags.Changed("container") && !flags.Changed("pid-file") && profile.Target > 0 {
+		f.pid = profile.Target
+	}
+	if !slices.ContainsFunc(nsFlagOrder, flags.Changed) {
+		for _, nsType := range profile.Namespaces {
+			enabled, ok := f.nsFlags[nsType]
+			if !ok {
+				return nil, fmt.Errorf("profile %s: unknown namespace type %q", f.profileName, nsType)
+			}
+			*enabled = true
+		}
+	}
+	// Later entries win, so --env overrides the profile.
+	f.setEnv = append(slices.Clone(profile.Env), f.setEnv...)
+	return profile.Command, nil
+}
+
+// resolveTarget settles the target PID and the namespaces to enter from
+// the flags and the environment, and waits for the target with
+// --wait-timeout.
+func (f *enterFlags) resolveTarget(flags *pflag.FlagSet) error {
+	// The target is --target, else --container or --pid-file, else
+	// $NSENTER_TARGET_PID.
+	targetSet := flags.Changed("target")
+	if f.pidFile != "" && !targetSet {
+		resolved, err := ns.ReadPidFile(f.pidFile)
+		if err != nil {
+			return err
+		}
+		f.pid = resolved
+	}
+
+	if f.container != "" {
+		if targetSet || f.pidFile != "" {
+			return errors.New("--container cannot be combined with --target or --pid-file")
+		}
+		resolver, err := ns.RuntimeResolver(f.containerRuntime)
+		if err != nil {
+			return err
+		}
+		resolved, err := resolver.ResolvePID(f.container)
+		if err != nil {
+			return err
+		}
+		f.pid = resolved
+	}
+
+	// --unshare runs without a target, so the variable does not apply.
+	if f.pid < 0 && len(f.unshareNs) == 0 {
+		if resolved, ok := ns.ResolvePidFromEnv(); ok {
+			f.pid = resolved
+		}
+	}
+	// Likewise $NSENTER_NAMESPACES stands in for the --TYPE flags.
+	if env := os.Getenv("NSENTER_NAMESPACES"); env != "" && !slices.ContainsFunc(nsFlagOrder, func(nsType string) bool { return *f.nsFlags[nsType] }) {
+		for _, nsType := range strings.Split(env, ",") {
+			enabled, ok := f.nsFlags[strings.TrimSpace(nsType)]
+			if !ok {
+				return fmt.Errorf("NSENTER_NAMESPACES: unknown namespace type %q", nsType)
+			}
+			*enabled = true
+		}
+	}
+
+	if f.waitTimeout > 0 && f.pid > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), f.waitTimeout)
+		defer cancel()
+		return ns.WaitForPid(ctx, f.pid)
+	}
+	return nil
+}
+
+// runAction runs the first of the modes that do something other than run
+// a command, such as --pin or --list-ns, and reports whether there was one.
+func (f *enterFlags) runAction() (bool, error) {
+	switch {
+	case len(f.pins) > 0 || len(f.unpins) > 0:
+		return true, f.pin()
+	case f.listNs || f.listNsJSON:
+		if f.pid < 0 {
+			return true, errUsage
+		}
+		return true, listNamespaces(f.pid, f.listNsJSON)
+	case f.mountInfo:
+		mntPid := f.pid
+		if *f.nsTargets["mnt"] >= 0 {
+			mntPid = *f.nsTargets["mnt"]
+		}
+		if mntPid < 0 {
+			return true, errors.New("--mount-info needs a target")
+		}
+		entries, err := ns.ParseMountInfo(mntPid)
+		if err != nil {
+			return true, err
+		}
+		return true, printJSON(entries)
+	case f.groupByNs != "":
+		return true, printGroups(f.groupByNs)
+	case f.diff:
+		if f.pid < 0 || f.comparePid < 0 {
+			return true, errors.New("--diff needs --target and --compare")
+		}
+		return true, printDiff(f.pid, f.comparePid)
+	case f.dumpTree:
+		root := f.pid
+		if root < 0 {
+			root = 1
+		}
+		tree, err := ns.DumpNamespaceTree(root)
+		if err != nil {
+			return true, err
+		}
+		return true, printJSON(tree)
+	}
+	return false, nil
+}
+
+// pin makes the pins of --pin and removes those of --unpin.
+func (f *enterFlags) pin() error {
+	if len(f.pins) > 0 && f.pid < 0 {
+		return errors.New("--pin needs a target")
+	}
+	for path, nsType := range f.pins {
+		if err := ns.PinNamespace(f.pid, nsType, path); err != nil {
+			return err
+		}
+	}
+	for _, path := range f.unpins {
+		if err := ns.UnpinNamespace(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeProfile saves the target, namespaces, command argv and --env
+// values as the profile --save-profile.
+func (f *enterFlags) writeProfile(argv []string) error {
+	profile := ns.Profile{Command: argv, Env: f.setEnv}
+	if f.pid > 0 {
+		profile.Target = f.pid
+	}
+	for _, nsType := range nsFlagOrder {
+		if *f.nsFlags[nsType] {
+			profile.Namespaces = append(profile.Namespaces, nsType)
+		}
+	}
+	return ns.SaveProfile(f.profilesFile, f.saveProfile, profile)
+}
+
+// commandLine returns the command to run and its arguments: argv, or
+// with --exec-path that executable given all of positional, or without
+// either the user's shell.
+func (f *enterFlags) commandLine(argv, positional []string) (string, []string, error) {
+	if f.execPath != "" {
+		exe, err := resolveExecPath(f.execPath, f.pid, *f.nsFlags["mnt"])
+		if err != nil {
+			return "", nil, err
+		}
+		argv = append([]string{exe}, positional...)
+	}
+	if len(argv) > 0 {
+		return argv[0], argv[1:], nil
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell, nil, nil
+	}
+	return "/bin/sh", nil, nil
+}
+
+// validateFlags rejects combinations of flags the CLI cannot run, before
+// the config is built; NsenterConfig.Validate checks the rest.
+func (f *enterFlags) validateFlags(command string) error {
+	hasNsTarget := false
+	for _, p := range f.nsTargets {
+		hasNsTarget = hasNsTarget || *p >= 0
+	}
+	if len(f.unshareNs) > 0 && (f.pid >= 0 || len(f.nsPaths) > 0 || hasNsTarget) {
+		return errors.New("--unshare and --target are mutually exclusive")
+	}
+	if (f.pid < 0 && len(f.nsPaths) == 0 && !hasNsTarget && len(f.unshareNs) == 0) || command == "" {
+		return errUsage
+	}
+	if f.noFork && f.usePTY {
+		return errors.New("--no-fork cannot be combined with --pty, which always forks")
+	}
+	if f.mountProc {
+		if !*f.nsFlags["mnt"] || !*f.nsFlags["pid"] {
+			return errors.New("--mount-proc needs --mnt and --pid")
+		}
+		if f.noFork {
+			// procfs shows the pid namespace of whoever mounts it.
+			return errors.New("--mount-proc cannot be combined with --no-fork")
+		}
+	}
+	return nil
+}
+
+// enabledNamespaces returns the namespace types to enter: those of the
+// --TYPE flags, or with --all-ns every one of the target's that differs
+// from nsenter's but those of --except.
+func (f *enterFlags) enabledNamespaces() (map[string]bool, error) {
+	enabled := map[string]bool{}
+	for nsType, on := range f.nsFlags {
+		enabled[nsType] = *on
+	}
+	if f.allNs {
+		if slices.ContainsFunc(nsFlagOrder, func(nsType string) bool { return *f.nsFlags[nsType] }) {
+			return nil, errors.New("--all-ns cannot be combined with --TYPE flags; leave namespaces out with --except")
+		}
+		if f.pid <= 0 {
+			return nil, errors.New("--all-ns needs a target")
+		}
+		types, err := ns.TargetNamespaceTypes(f.pid)
+		if err != nil {
+			return nil, err
+		}
+		for _, nsType := range types {
+			if !slices.Contains(f.exceptNs, nsType) {
+				enabled[nsType] = true
+			}
+		}
+		// Like nsenter -a: joining a namespace we are already in is at best
+		// pointless and, for the user namespace, an error.
+		f.skipIfSame = true
+	}
+	for _, nsType := range f.exceptNs {
+		if _, ok := ns.NamespaceTypes[nsType]; !ok {
+			return nil, fmt.Errorf("--except: unknown namespace type %q", nsType)
+		}
+	}
+	return enabled, nil
+}
+
+// buildConfig returns the config that runs command with args as the flags
+// say. Its AuditLog, if any, is the caller's to close.
+func (f *enterFlags) buildConfig(command string, args []string) (*ns.NsenterConfig, error) {
+	opts := []ns.NsenterOption{ns.WithCommand(command, args...)}
+	enabledNs, err := f.enabledNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	for nsType, enabled := range enabledNs {
+		if enabled {
+			opts = append(opts, ns.WithNamespace(nsType))
+		}
+	}
+	for nsType, p := range f.nsTargets {
+		if *p >= 0 {
+			opts = append(opts, ns.WithNsTarget(nsType, *p))
+		}
+	}
+	for nsType, path := range f.nsPaths {
+		opts = append(opts, ns.WithNsPath(nsType, path))
+	}
+	if f.uid >= 0 || f.gid >= 0 || f.username != "" {
+		cred, err := credential(f.uid, f.gid, f.username, mntNsPath(f.pid, enabledNs["mnt"], f.nsTargets["mnt"], f.nsPaths))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, func(c *ns.NsenterConfig) { c.Credential = cred })
+	}
+
+	config := ns.NewNsenterConfig(f.pid, opts...)
+	config.Timeout = f.timeout
+	config.Env = f.setEnv
+	config.ClearEnv = !f.preserveEnv
+	config.UnsetEnv = f.unsetEnv
+	config.Dir = f.wd
+	config.PivotRoot = f.pivotRoot
+	config.RemountSys = f.remountSys
+	config.Chroot = f.chroot
+	config.Setsid = f.setsid
+	config.Setpgid = f.setpgid
+	config.NoFork = f.noFork
+	config.TargetDir = f.targetWd
+	config.PreflightCheck = f.preflight
+	config.PreserveCredentials = f.preserveCreds
+	config.AmbientCaps = f.ambientCaps
+	config.UidMappings = f.uidMaps
+	config.GidMappings = f.gidMaps
+	config.SeccompProfile = f.seccompProfile
+	config.Unshare = f.unshareNs
+	config.NoNewPrivs = f.noNewPrivs
+	config.SkipSameNs = f.skipIfSame
+	if f.auditLog != "" {
+		audit, err := ns.NewAuditLogger(f.auditLog)
+		if err != nil {
+			return nil, err
+		}
+		config.AuditLog = audit
+	}
+	if f.verbose {
+		logLevel.Set(slog.LevelDebug)
+		config.Logger = logger
+	}
+	return config, nil
+}
+
+// start checks config, logging its warnings, and runs it, or with
+// --dry-run prints what it would do.
+func (f *enterFlags) start(config *ns.NsenterConfig) (int, error) {
+	failed := false
+	for _, err := range config.Validate() {
+		var warning *ns.ConfigWarning
+		if errors.As(err, &warning) {
+			logger.Warn(warning.Msg)
+			continue
+		}
+		logger.Error(err.Error())
+		failed = true
+	}
+	if failed {
+		return 1, nil
+	}
+	if f.metricsAddr != "" {
+		if err := serveMetrics(f.metricsAddr); err != nil {
+			return 1, err
+		}
+	}
+	if f.dryRun {
+		return exitStatus(config.DryRun(os.Stdout))
+	}
+	runCmd := config.Run
+	if f.usePTY {
+		runCmd = config.RunWithPTY
+	}
+	if err := runCmd(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			logger.Error(err.Error())
+		}
+		return ns.ExitCode(err), nil
+	}
+	return 0, nil
+}
+
+// targetFlag is a PID flag that also takes a /proc/PID path; see
+// ns.ParseTarget. Unset, it is -1.
+type targetFlag int
+
+func (t *targetFlag) String() string { return strconv.Itoa(int(*t)) }
+func (t *targetFlag) Type() string   { return "int" }
+
+func (t *targetFlag) Set(v string) error {
+	pid, err := ns.ParseTarget(v)
+	*t = targetFlag(pid)
+	return err
+}
+
+// newTargetFlag defines a targetFlag in flags.
+func newTargetFlag(flags *pflag.FlagSet, name, usage string) *int {
+	pid := -1
+	flags.Var((*targetFlag)(&pid), name, usage)
+	return &pid
+}
+
+// parsePin parses a --pin value: a path whose base name is the namespace
+// type, or type:path.
+func parsePin(v string) (nsType, path string, err error) {
+	nsType, path, ok := strings.Cut(v, ":")
+	if !ok {
+		nsType, path = filepath.Base(v), v
+	}
+	if _, known := ns.NamespaceTypes[nsType]; !known {
+		return "", "", fmt.Errorf("unknown namespace type %q", nsType)
+	}
+	return nsType, path, nil
+}
+
+// resolveExecPath turns --exec-path into the executable to run. proc-exe
+// is the target's own: its path inside the target's filesystem when the
+// mount namespace is entered, /proc/PID/exe otherwise.
+func resolveExecPath(execPath string, pid int, mnt bool) (string, error) {
+	if execPath != "proc-exe" {
+		return execPath, nil
+	}
+	if pid <= 0 {
+		return "", errors.New("--exec-path=proc-exe needs --target")
+	}
+	if !mnt {
+		return fmt.Sprintf("/proc/%d/exe", pid), nil
+	}
+	return ns.ResolveExePath(pid)
+}
+
+// printGroups prints the processes in each nsType namespace, one namespace
+// per line, ordered by inode. With a partial scan the groups found are
+// printed before the error is returned.
+func printGroups(nsType string) error {
+	groups, err := ns.ListAllNamespacedPids(nsType)
+	var partial *ns.PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "INODE\tNPROCS\tPIDS")
+	for _, inode := range slices.Sorted(maps.Keys(groups)) {
+		pids := groups[inode]
+		strs := make([]string, len(pids))
+		for i, pid := range pids {
+			strs[i] = strconv.Itoa(pid)
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\n", inode, len(pids), strings.Join(strs, ","))
+	}
+	if flushErr := w.Flush(); flushErr != nil {
+		return flushErr
+	}
+	return err
+}
+
+// listNamespaces prints the namespaces of pid as a table or as JSON.
+func listNamespaces(pid int, asJSON bool) error {
+	infos, err := ns.ListNamespaces(pid)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tINODE\tDEVICE\tPATH")
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", info.Type, info.Inode, info.Device, info.Path)
+	}
+	return w.Flush()
+}
+
+// mntNsPath returns the mount namespace the command will run in, or "" if
+// it keeps nsenter's.
+func mntNsPath(pid int, mnt bool, mntTarget *int, nsPaths map[string]string) string {
+	if path, ok := nsPaths["mnt"]; ok {
+		return path
+	}
+	if *mntTarget >= 0 {
+		return ns.NsPath(*mntTarget, "mnt")
+	}
+	if mnt {
+		return ns.NsPath(pid, "mnt")
+	}
+	return ""
+}
+
+// credential builds the command's credentials from --uid, --gid and
+// --username. The user is looked up in the mount namespace at mntPath, if
+// any; explicit IDs win over the user's, and missing ones stay nsenter's.
+func credential(uid, gid int, username, mntPath string) (*syscall.Credential, error) {
+	cred := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	if username != "" {
+		var u *ns.User
+		var err error
+		if mntPath == "" {
+			u, err = ns.LookupUser("/etc/passwd", username)
+		} else {
+			var f *os.File
+			if f, err = os.Open(mntPath); err == nil {
+				u, err = ns.LookupUserInMountNs(f, username)
+				f.Close()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		cred.Uid, cred.Gid = u.Uid, u.Gid
+	}
+	if uid >= 0 {
+		cred.Uid = uint32(uid)
+	}
+	if gid >= 0 {
+		cred.Gid = uint32(gid)
+	}
+	return cred, nil
+}
+
+// printDiff prints a table of the namespaces of pid1 and pid2.
+func printDiff(pid1, pid2 int) error {
+	diff, err := ns.NsDiff(pid1, pid2)
+	if err != nil {
+		return err
+	}
+	types := slices.Sorted(maps.Keys(diff))
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "TYPE\tPID %d\tPID %d\tSHARED\n", pid1, pid2)
+	for _, nsType := range types {
+		e := diff[nsType]
+		shared := "no"
+		if e.Same {
+			shared = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", e.Type, e.Inode1, e.Inode2, shared)
+	}
+	return w.Flush()
+}
+
+// serveMetrics starts serving the namespace metrics on addr in the
+// background.
+func serveMetrics(addr string) error {
+	reg := prometheus.NewRegistry()
+	if err := ns.RegisterMetrics(reg); err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	go http.Serve(l, mux)
+	return nil
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
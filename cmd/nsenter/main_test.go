@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"bustakube.com/nsenter/pkg/ns"
+	"bustakube.com/nsenter/pkg/ns/nstest"
+)
+
+func TestMain(m *testing.M) {
+	// --mount-proc runs /proc/self/exe, here the test binary, as its helper.
+	if os.Getenv(mountProcEnv) == "1" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs main with args and returns the status it exits with.
+func runMain(t *testing.T, args ...string) int {
+	t.Helper()
+	code := -1
+	oldArgs, oldExit := os.Args, osExit
+	t.Cleanup(func() { os.Args, osExit = oldArgs, oldExit })
+	os.Args = append([]string{"nsenter"}, args...)
+	osExit = func(c int) { code = c }
+	main()
+	return code
+}
+
+// runMainOutput is runMain that also returns what was written to stdout,
+// including by a forked command.
+func runMainOutput(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	oldStdout := os.Stdout
+	os.Stdout = f
+	code := runMain(t, args...)
+	os.Stdout = oldStdout
+	out, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(out)
+}
+
+func TestMainExitCode(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"version", []string{"--version"}, 0},
+		{"unknown flag", []string{"--bogus"}, 1},
+		{"no target", []string{"--net", "/bin/true"}, 1},
+		// Above the kernel's highest pid_max, so never a live process.
+		{"gone target", []string{"--target", "1073741824", "--net", "/bin/true"}, 1},
+		{"bad target", []string{"list", "not-a-pid"}, 1},
+		{"unknown subcommand flag", []string{"list", "--bogus"}, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NSENTER_TARGET_PID", "")
+			if got := runMain(t, tt.args...); got != tt.want {
+				t.Errorf("nsenter %v exited %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestUnshareIgnoresTargetEnv checks that $NSENTER_TARGET_PID, a fallback
+// for --target, does not make --unshare fail as if both were given.
+func TestUnshareIgnoresTargetEnv(t *testing.T) {
+	requireRoot(t)
+	t.Setenv("NSENTER_TARGET_PID", strconv.Itoa(os.Getpid()))
+	args := []string{"--unshare", "uts", "/bin/true"}
+	if got := runMain(t, args...); got != 0 {
+		t.Errorf("nsenter %v exited %d, want 0", args, got)
+	}
+}
+
+func requireRoot(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to join namespaces it did not create")
+	}
+}
+
+// TestForkExitCode checks that in the fork path, taken for --pid and
+// --timeout, nsenter exits with the status of the command, shell-style.
+func TestForkExitCode(t *testing.T) {
+	requireRoot(t)
+	target := strconv.Itoa(nstest.NewTestNamespace(t, "pid").(*ns.ProcNamespace).Pid)
+	for _, tt := range []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"exit status", []string{"sh", "-c", "exit 7"}, 7},
+		{"killed", []string{"sh", "-c", "kill -KILL $$"}, 128 + 9},
+		{"timed out", []string{"--timeout", "100ms", "sleep", "10"}, 124},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--target", target, "--pid"}, tt.args...)
+			if got := runMain(t, args...); got != tt.want {
+				t.Errorf("nsenter %v exited %d, want %d", args, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMountProc runs ps with --mount-proc in a test pid namespace. It must
+// only see the sleep holding the namespace, as PID 1, and itself.
+func TestMountProc(t *testing.T) {
+	requireRoot(t)
+	if _, err := exec.LookPath("ps"); err != nil {
+		t.Skip(err)
+	}
+	pid := strconv.Itoa(nstest.NewTestNamespace(t, "pid").(*ns.ProcNamespace).Pid)
+	// A mount namespace of its own, so the new /proc cannot leak into the
+	// test's.
+	mnt := strconv.Itoa(nstest.NewTestNamespace(t, "mnt").(*ns.ProcNamespace).Pid)
+
+	code, out := runMainOutput(t, "--target", pid, "--pid", "--mnt", "--mnt-target", mnt, "--mount-proc", "ps", "-e", "-o", "pid=,comm=")
+	if code != 0 {
+		t.Fatalf("nsenter --mount-proc ps exited %d:\n%s", code, out)
+	}
+	procs := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		pid, comm, _ := strings.Cut(strings.TrimSpace(line), " ")
+		procs[pid] = strings.TrimSpace(comm)
+	}
+	if procs["1"] != "sleep" {
+		t.Errorf("PID 1 is %q, want the sleep holding the namespace", procs["1"])
+	}
+	for pid, comm := range procs {
+		if comm != "sleep" && comm != "ps" {
+			t.Errorf("ps sees PID %s, %s, from outside the pid namespace:\n%s", pid, comm, out)
+		}
+	}
+}
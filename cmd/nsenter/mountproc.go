@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// mountProcEnv marks a re-exec of nsenter as the --mount-proc helper. procfs
+// has to be mounted by a process inside the target pid namespace, so with
+// --mount-proc the forked child is nsenter itself, which mounts /proc and
+// then execs the real command.
+const mountProcEnv = "_NSENTER_MOUNT_PROC"
+
+// mountProcCommand wraps command so that /proc is remounted before it runs.
+func mountProcCommand(command string, args []string) (string, []string) {
+	return "/proc/self/exe", append([]string{command}, args...)
+}
+
+// runMountProcHelper takes over when nsenter was started as the
+// --mount-proc helper. It only returns, with the exit status, on failure.
+//
+// The helper first gets a private copy of the target's mount namespace, so
+// the new /proc only affects the command and not the target itself.
+func runMountProcHelper() int {
+	os.Unsetenv(mountProcEnv)
+	if len(os.Args) < 2 {
+		logger.Error("mount-proc helper: no command")
+		return 1
+	}
+	if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+		logger.Error("mount-proc helper: unshare mount namespace", "err", err)
+		return 1
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+		logger.Error("mount-proc helper: make / slave", "err", err)
+		return 1
+	}
+	if err := ns.RemountProc(); err != nil {
+		logger.Error("mount-proc helper", "err", err)
+		return 1
+	}
+	path, err := exec.LookPath(os.Args[1])
+	if err != nil {
+		logger.Error("mount-proc helper", "err", err)
+		return 1
+	}
+	if err := unix.Exec(path, os.Args[1:], os.Environ()); err != nil {
+		logger.Error("mount-proc helper: exec", "path", path, "err", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, for builds outside a VCS checkout:
+//
+//	go build -ldflags "-X main.version=1.0.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/nsenter
+//
+// Whatever is left empty is taken from the build info Go embeds.
+var (
+	version   string
+	commit    string
+	buildTime string
+)
+
+// versionLine returns the --version output, in the fixed form
+//
+//	go-nsenter version VERSION (commit COMMIT, built TIME with GOVERSION)
+//
+// with "unknown" for what is not known, so scripts can split it on spaces.
+func versionLine() string {
+	v, c, t := version, commit, buildTime
+	dirty := false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value
+				if len(c) > 7 {
+					c = c[:7]
+				}
+			case s.Key == "vcs.time" && t == "":
+				t = s.Value
+			case s.Key == "vcs.modified" && s.Value == "true" && commit == "":
+				dirty = true
+			}
+		}
+	}
+	if dirty && c != "" {
+		c += "-dirty"
+	}
+	if v == "" {
+		v = "devel"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if t == "" {
+		t = "unknown"
+	}
+	return fmt.Sprintf("go-nsenter version %s (commit %s, built %s with %s)", v, c, t, runtime.Version())
+}
@@ -0,0 +1,140 @@
+package ns_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"bustakube.com/nsenter/pkg/ns"
+	"bustakube.com/nsenter/pkg/ns/nstest"
+)
+
+// benchLoop locks the benchmark goroutine to its thread and runs enter b.N
+// times, passing a descriptor of the thread's own nsType namespace to go
+// back to. The thread is never unlocked: it ends up in the namespaces
+// entered, and in a mount namespace of its own.
+func benchLoop(b *testing.B, nsType string, enter func(home int) error) {
+	runtime.LockOSThread()
+	home, err := os.Open("/proc/thread-self/ns/" + nsType)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer home.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := enter(int(home.Fd())); err != nil {
+			if errors.Is(err, ns.ErrPermission) {
+				b.Skip(err)
+			}
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEnterNamespace measures entering a namespace of each type and
+// going back. proc opens /proc/PID/ns/TYPE on every iteration, as
+// EnterNamespace does; fd joins a descriptor opened up front.
+func BenchmarkEnterNamespace(b *testing.B) {
+	requireRoot(b)
+	for _, nsType := range enterableTypes {
+		n := nstest.NewTestNamespace(b, nsType)
+		pid := n.(*ns.ProcNamespace).Pid
+		target, err := os.Open(n.Path())
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer target.Close()
+
+		b.Run(nsType+"/proc", func(b *testing.B) {
+			benchLoop(b, nsType, func(home int) error {
+				if err := ns.EnterNamespace(pid, nsType); err != nil {
+					return err
+				}
+				return ns.EnterNamespaceByFd(home, nsType)
+			})
+		})
+		b.Run(nsType+"/fd", func(b *testing.B) {
+			benchLoop(b, nsType, func(home int) error {
+				if err := ns.EnterNamespaceByFd(int(target.Fd()), nsType); err != nil {
+					return err
+				}
+				return ns.EnterNamespaceByFd(home, nsType)
+			})
+		})
+	}
+}
+
+// BenchmarkEnterNamespaceCached measures entering a namespace the thread is
+// already in, with the cache of NsenterConfig.UseCache, which skips setns,
+// and without it.
+func BenchmarkEnterNamespaceCached(b *testing.B) {
+	requireRoot(b)
+	for _, nsType := range enterableTypes {
+		n := nstest.NewTestNamespace(b, nsType)
+		target, err := os.Open(n.Path())
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer target.Close()
+		fd := int(target.Fd())
+
+		b.Run(nsType+"/cached", func(b *testing.B) {
+			// The thread is thrown away after, but its TID may be reused.
+			defer ns.ForgetThread()
+			benchLoop(b, nsType, func(int) error { return ns.EnterNamespaceByFdCached(fd, nsType) })
+		})
+		b.Run(nsType+"/uncached", func(b *testing.B) {
+			benchLoop(b, nsType, func(int) error { return ns.EnterNamespaceByFd(fd, nsType) })
+		})
+	}
+}
+
+// benchPids starts n processes that live until the benchmark ends and
+// returns their PIDs, so the listing benchmarks compare like with like.
+func benchPids(b *testing.B, n int) []int {
+	b.Helper()
+	pids := make([]int, 0, n)
+	for range n {
+		cmd := exec.Command("sleep", "infinity")
+		if err := cmd.Start(); err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		})
+		pids = append(pids, cmd.Process.Pid)
+	}
+	return pids
+}
+
+// BenchmarkListNamespacesBatch measures listing the namespaces of 64
+// processes with ListNamespacesBatch, one worker per CPU.
+func BenchmarkListNamespacesBatch(b *testing.B) {
+	pids := benchPids(b, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ns.ListNamespacesBatch(pids, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkListNamespacesSerial lists as many processes as
+// BenchmarkListNamespacesBatch, calling ListNamespaces for one at a time.
+func BenchmarkListNamespacesSerial(b *testing.B) {
+	pids := benchPids(b, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pid := range pids {
+			if _, err := ns.ListNamespaces(pid); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
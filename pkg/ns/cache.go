@@ -0,0 +1,45 @@
+package ns
+
+import (
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// threadNs keys the inode cache: namespaces belong to OS threads, and a
+// thread locked with runtime.LockOSThread keeps its TID.
+type threadNs struct {
+	tid    int
+	nsType string
+}
+
+// nsCache records, per thread and type, the namespace that setnsFd last
+// entered for a config with UseCache.
+var nsCache sync.Map // threadNs -> nsID
+
+// cachedIn reports whether the calling thread is recorded as having entered
+// the namespace behind fd. It returns that namespace's ID for remember.
+func cachedIn(fd int, nsType string) (bool, nsID) {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return false, nsID{}
+	}
+	id := nsID{dev: uint64(st.Dev), ino: st.Ino}
+	v, ok := nsCache.Load(threadNs{unix.Gettid(), nsType})
+	return ok && v.(nsID) == id, id
+}
+
+// remember records that the calling thread is now in namespace id.
+func remember(nsType string, id nsID) {
+	nsCache.Store(threadNs{unix.Gettid(), nsType}, id)
+}
+
+// forgetThread drops the calling thread's cache entries. It must be called
+// whenever a thread that used the cache moves namespaces by other means or
+// is about to exit, since a later thread may reuse its TID.
+func forgetThread() {
+	tid := unix.Gettid()
+	for _, nsType := range enterOrder {
+		nsCache.Delete(threadNs{tid, nsType})
+	}
+}
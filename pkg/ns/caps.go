@@ -0,0 +1,246 @@
+package ns
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// capNames lists capability names indexed by their number.
+var capNames = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_DAC_READ_SEARCH",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN",
+	"CAP_NET_RAW",
+	"CAP_IPC_LOCK",
+	"CAP_IPC_OWNER",
+	"CAP_SYS_MODULE",
+	"CAP_SYS_RAWIO",
+	"CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT",
+	"CAP_SYS_ADMIN",
+	"CAP_SYS_BOOT",
+	"CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME",
+	"CAP_SYS_TTY_CONFIG",
+	"CAP_MKNOD",
+	"CAP_LEASE",
+	"CAP_AUDIT_WRITE",
+	"CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE",
+	"CAP_MAC_ADMIN",
+	"CAP_SYSLOG",
+	"CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ",
+	"CAP_PERFMON",
+	"CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+const (
+	capSysChroot = 18
+	capSysAdmin  = 21
+)
+
+// setnsCaps lists the capabilities, beyond CAP_SYS_ADMIN, that setns needs
+// for a namespace type.
+var setnsCaps = map[string][]uint{
+	"mnt": {capSysChroot},
+}
+
+// CapName returns the name of capability c, or its number if unknown.
+func CapName(c uint) string {
+	if int(c) < len(capNames) {
+		return capNames[c]
+	}
+	return strconv.FormatUint(uint64(c), 10)
+}
+
+// ParseCapability returns the number of the capability called name, such
+// as CAP_NET_ADMIN or net_admin, or given by number.
+func ParseCapability(name string) (uint, error) {
+	upper := strings.ToUpper(name)
+	if !strings.HasPrefix(upper, "CAP_") {
+		upper = "CAP_" + upper
+	}
+	for c, capName := range capNames {
+		if capName == upper {
+			return uint(c), nil
+		}
+	}
+	if c, err := strconv.ParseUint(name, 10, 0); err == nil && c < 64 {
+		return uint(c), nil
+	}
+	return 0, fmt.Errorf("unknown capability %q", name)
+}
+
+// effectiveCaps returns the CapEff mask of the calling process.
+func effectiveCaps() (uint64, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "CapEff:"); ok {
+			return strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no CapEff in /proc/self/status")
+}
+
+// capList names the capabilities set in mask.
+func capList(mask uint64) []string {
+	var names []string
+	for c := uint(0); c < 64; c++ {
+		if mask&(1<<c) != 0 {
+			names = append(names, CapName(c))
+		}
+	}
+	return names
+}
+
+// CheckSetnsCapability reports whether the calling process has the effective
+// capabilities setns needs to join an nsType namespace owned by its current
+// user namespace. The error names the missing capabilities and is
+// ErrPermission under errors.Is.
+//
+// Joining a user namespace needs no capability in the caller's namespace, so
+// "user" always passes; whether the target accepts us is only known at setns.
+func CheckSetnsCapability(nsType string) error {
+	if _, ok := NamespaceTypes[nsType]; !ok {
+		return newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+	}
+	if nsType == "user" {
+		return nil
+	}
+
+	eff, err := effectiveCaps()
+	if err != nil {
+		return fmt.Errorf("read effective capabilities: %w", err)
+	}
+
+	var missing []string
+	for _, c := range append([]uint{capSysAdmin}, setnsCaps[nsType]...) {
+		if eff&(1<<c) == 0 {
+			missing = append(missing, CapName(c))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &NsError{
+		NsType: nsType,
+		Op:     "enter",
+		Err: fmt.Errorf("requires %s; current effective caps: [%s]",
+			strings.Join(missing, ", "), strings.Join(capList(eff), ", ")),
+		kind: ErrPermission,
+	}
+}
+
+// PreserveCapabilities runs fn with PR_SET_KEEPCAPS set on the calling
+// thread and then raises the effective capabilities it had before fn again,
+// as far as its permitted set still allows.
+//
+// Two transitions inside fn cost capabilities. A setuid away from uid 0
+// clears the permitted and effective sets; keepcaps keeps the permitted
+// set, but the effective one is cleared all the same. Joining a user
+// namespace replaces all capabilities with a full set in that namespace,
+// and a setuid to a non-zero uid there drops them the same way. Restoring
+// the effective set afterwards lets the rest of the setup, such as
+// installing a seccomp filter without no_new_privs, still use them. An
+// execve by a non-root user recomputes the sets from the file and ambient
+// capabilities, so they still do not reach the command that way.
+func PreserveCapabilities(fn func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var saved [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &saved[0]); err != nil {
+		return fmt.Errorf("capget: %w", err)
+	}
+	keep, err := unix.PrctlRetInt(unix.PR_GET_KEEPCAPS, 0, 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("get keepcaps: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set keepcaps: %w", err)
+	}
+	defer unix.Prctl(unix.PR_SET_KEEPCAPS, uintptr(keep), 0, 0, 0)
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	var caps [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &caps[0]); err != nil {
+		return fmt.Errorf("capget: %w", err)
+	}
+	for i := range caps {
+		caps[i].Effective |= saved[i].Effective & caps[i].Permitted
+	}
+	if err := unix.Capset(&hdr, &caps[0]); err != nil {
+		return fmt.Errorf("capset: %w", err)
+	}
+	return nil
+}
+
+// SetAmbientCaps raises caps in the ambient set of the calling thread,
+// first adding them to its inheritable set, which the kernel requires. The
+// ambient set survives execve of a program without file capabilities, so a
+// command running as a non-root user keeps these capabilities in its
+// permitted and effective sets. Each capability must already be permitted;
+// ambient capabilities need Linux 4.3.
+func SetAmbientCaps(caps []uint) error {
+	if len(caps) == 0 {
+		return nil
+	}
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("capget: %w", err)
+	}
+	for _, c := range caps {
+		if c >= 64 {
+			return fmt.Errorf("unknown capability %d", c)
+		}
+		if data[c/32].Permitted&(1<<(c%32)) == 0 {
+			return fmt.Errorf("raise ambient %s: not in the permitted set", CapName(c))
+		}
+		data[c/32].Inheritable |= 1 << (c % 32)
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("capset: %w", err)
+	}
+	for _, c := range caps {
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(c), 0, 0); err != nil {
+			return fmt.Errorf("raise ambient %s: %w", CapName(c), err)
+		}
+	}
+	return nil
+}
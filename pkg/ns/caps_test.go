@@ -0,0 +1,90 @@
+package ns_test
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// TestPreserveCapabilities switches a thread from root to nobody, which
+// clears its effective capabilities unless PreserveCapabilities wraps the
+// switch.
+func TestPreserveCapabilities(t *testing.T) {
+	requireRoot(t)
+	// setresuid(2) itself, for the calling thread only; unix.Setresuid
+	// changes every thread of the process.
+	setuidNobody := func() error {
+		if _, _, errno := unix.RawSyscall(unix.SYS_SETRESUID, 65534, 65534, 65534); errno != 0 {
+			return fmt.Errorf("setresuid: %w", errno)
+		}
+		return nil
+	}
+	for _, tt := range []struct {
+		name     string
+		preserve bool
+	}{
+		{"preserved", true},
+		{"dropped", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after *ns.ProcStatus
+			err := onLockedThread(func() error {
+				var err error
+				if before, err = ns.ParseProcStatus(unix.Gettid()); err != nil {
+					return err
+				}
+				if tt.preserve {
+					err = ns.PreserveCapabilities(setuidNobody)
+				} else {
+					err = setuidNobody()
+				}
+				if err != nil {
+					return err
+				}
+				after, err = ns.ParseProcStatus(unix.Gettid())
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if before.CapEff == 0 {
+				t.Fatal("root thread has no effective capabilities")
+			}
+			want := uint64(0)
+			if tt.preserve {
+				want = before.CapEff
+			}
+			if after.CapEff != want {
+				t.Errorf("CapEff %#x after the switch to nobody, want %#x (before: %#x)", after.CapEff, want, before.CapEff)
+			}
+		})
+	}
+}
+
+// TestAmbientCaps opens a raw socket as nobody, which only the
+// CAP_NET_RAW raised in the ambient set allows.
+func TestAmbientCaps(t *testing.T) {
+	requireRoot(t)
+	helper := copyExecutable(t, os.Args[0], sharedTempDir(t), 0o755)
+	rawSocket := func(caps []uint) (string, error) {
+		c := &ns.NsenterConfig{
+			Command:     helper,
+			Credential:  &syscall.Credential{Uid: 65534, Gid: 65534},
+			AmbientCaps: caps,
+			Env:         []string{helperEnv + "=raw-socket"},
+			Dir:         "/",
+		}
+		return runConfig(t, c)
+	}
+	if out, err := rawSocket(nil); err == nil {
+		t.Skipf("nobody may open a raw socket without CAP_NET_RAW\n%s", out)
+	}
+	if out, err := rawSocket([]uint{unix.CAP_NET_RAW}); err != nil {
+		t.Errorf("raw socket with ambient CAP_NET_RAW: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,110 @@
+package ns
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// forwardedSignals are relayed from nsenter to the child's process group.
+var forwardedSignals = []os.Signal{unix.SIGINT, unix.SIGTERM, unix.SIGHUP, unix.SIGWINCH}
+
+// child is a command started in its own process group, with
+// forwardedSignals relayed to that group until it exits.
+//
+// When stdin is a terminal the child's group is made the foreground group,
+// so it can read from the terminal, and nsenter's group is put back in the
+// foreground once the child is done.
+type child struct {
+	cmd   *exec.Cmd
+	ttyFd int
+	isTTY bool
+	sigs  chan os.Signal
+}
+
+// newChild prepares cmd to be started as a child. Signals are caught from
+// here on, so none are lost before the child exists; call wait after
+// starting cmd, or stop if it could not be started.
+//
+// A child started with Setsid leads its own session and process group
+// already, and a session leader cannot also call setpgid, so it is left
+// alone.
+func newChild(cmd *exec.Cmd) *child {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &unix.SysProcAttr{}
+	}
+	setsid := cmd.SysProcAttr.Setsid
+	cmd.SysProcAttr.Setpgid = !setsid
+
+	ch := &child{cmd: cmd, ttyFd: int(os.Stdin.Fd())}
+	_, ttyErr := unix.IoctlGetTermios(ch.ttyFd, unix.TCGETS)
+	ch.isTTY = ttyErr == nil && cmd.Stdin == os.Stdin && !setsid
+	if ch.isTTY {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = ch.ttyFd
+	}
+
+	ch.sigs = make(chan os.Signal, 8)
+	signal.Notify(ch.sigs, forwardedSignals...)
+	return ch
+}
+
+// stop releases the signals caught by newChild.
+func (ch *child) stop() {
+	signal.Stop(ch.sigs)
+}
+
+// wait relays signals to the started child until it exits and returns the
+// result of cmd.Wait.
+func (ch *child) wait() error {
+	defer ch.stop()
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-ch.sigs:
+				_ = unix.Kill(-ch.cmd.Process.Pid, sig.(syscall.Signal))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := ch.cmd.Wait()
+	close(done)
+
+	if ch.isTTY {
+		// Taking the terminal back from the background raises SIGTTOU.
+		signal.Ignore(unix.SIGTTOU)
+		_ = unix.IoctlSetPointerInt(ch.ttyFd, unix.TIOCSPGRP, unix.Getpgrp())
+		signal.Reset(unix.SIGTTOU)
+	}
+	return err
+}
+
+// ExitCode returns the shell-style exit status for an error returned by
+// Run: 0 for nil, 124 if the command timed out (like GNU timeout), the
+// child's exit code if it exited, 128+signum if it was killed by a signal,
+// and 1 for any other error.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return 124
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 1
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
@@ -0,0 +1,107 @@
+package ns
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// Clone enters the namespace, unshares a new one of the same type, pins it
+// to a temporary file and goes back to the namespace the thread was in. The
+// original is left alone, so a caller can set up a throwaway copy of it;
+// release the copy with UnpinNamespace on its Path.
+//
+// What the new namespace starts with depends on its type, as with
+// unshare(2): a mnt or uts clone starts as a copy of the original, an ipc or
+// net one starts empty, and a time clone starts with the original's offsets
+// and is only joined by processes forked after entering it.
+//
+// A pid namespace cannot be cloned this way: the kernel will not hand out
+// a new pid namespace until its init has been forked. Clone the mnt
+// namespace first if needed, then enter the original pid namespace and
+// fork; unsharing pid from where the caller already is would make the new
+// namespace a child of the wrong one. A user namespace cannot be cloned
+// either, as Go programs are multithreaded.
+//
+// The work is done on a thread of its own, so the caller's thread is not
+// touched.
+func (h *nsHandle) Clone() (Namespace, error) {
+	if h.nsType == "user" || h.nsType == "pid" {
+		return nil, newNsError("clone", 0, h.nsType, ErrUnsupportedNamespace)
+	}
+	type result struct {
+		ns  Namespace
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		runtime.LockOSThread()
+		ns, stuck, err := h.clone()
+		if !stuck && reusable([]string{h.nsType}) {
+			// Back where it started.
+			runtime.UnlockOSThread()
+		}
+		done <- result{ns, err}
+	}()
+	r := <-done
+	return r.ns, r.err
+}
+
+// clone does the work of Clone on a locked thread. stuck reports that the
+// thread could not be brought back out of the namespace.
+func (h *nsHandle) clone() (ns Namespace, stuck bool, err error) {
+	if err := h.Enter(); err != nil {
+		// Enter leaves the thread where it was when it fails.
+		return nil, false, err
+	}
+	if err := cloneUnshare(h.nsType); err != nil {
+		return nil, h.Exit() != nil, newNsError("clone", 0, h.nsType, err)
+	}
+	// Hold on to the new namespace while going back: a mnt namespace
+	// cannot be bind-mounted from inside itself.
+	f, err := os.Open("/proc/thread-self/ns/" + childNsType(h.nsType))
+	if err != nil {
+		return nil, h.Exit() != nil, newNsError("clone", 0, h.nsType, err)
+	}
+	defer f.Close()
+	if err := h.Exit(); err != nil {
+		return nil, true, err
+	}
+
+	tmp, err := os.CreateTemp("", "nsenter-"+h.nsType+"-")
+	if err != nil {
+		return nil, false, newNsError("clone", 0, h.nsType, err)
+	}
+	path := tmp.Name()
+	tmp.Close()
+	src := filepath.Join("/proc/self/fd", fmt.Sprint(f.Fd()))
+	if err := unix.Mount(src, path, "", unix.MS_BIND, ""); err != nil {
+		os.Remove(path)
+		return nil, false, newNsError("clone", 0, h.nsType, fmt.Errorf("bind mount on %s: %w", path, err))
+	}
+	pinned, err := NewPinnedNamespace(path, h.nsType)
+	return pinned, false, err
+}
+
+// cloneUnshare unshares a new nsType namespace for the calling thread.
+func cloneUnshare(nsType string) error {
+	flags := NamespaceTypes[nsType]
+	if nsType == "mnt" {
+		// A thread has to stop sharing its filesystem attributes with
+		// the rest of the process before it can change mount namespace.
+		flags |= unix.CLONE_FS
+	}
+	return unix.Unshare(flags)
+}
+
+// childNsType is the /proc/thread-self/ns entry that a new nsType namespace
+// shows up under after unshare: a time namespace only applies to children.
+func childNsType(nsType string) string {
+	if nsType == "time" {
+		return nsType + "_for_children"
+	}
+	return nsType
+}
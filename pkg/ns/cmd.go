@@ -0,0 +1,234 @@
+package ns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// NsenterCmd is an exec.Cmd whose process starts in a given set of
+// namespaces. Use its Start, Run, Output and CombinedOutput methods rather
+// than those of the embedded Cmd, which would start the process in the
+// caller's namespaces.
+//
+// exec.Cmd forks from whichever OS thread happens to call Start, and a Go
+// program has many, so having locked some thread into the namespaces
+// elsewhere does not help: the fork has to happen on the very thread that
+// joined them. NsenterCmd therefore starts the process from a dedicated
+// thread that enters the namespaces first and is thrown away afterwards.
+// That still cannot cover user namespaces, which the kernel only lets
+// single-threaded processes join; those need the process to enter the
+// namespace itself before the Go runtime starts more threads, which is what
+// a re-exec trampoline does; see ReExec.
+type NsenterCmd struct {
+	*exec.Cmd
+	// NsFds maps namespace types to open namespace files. NsenterCmd does
+	// not close them; see Close.
+	NsFds map[string]*os.File
+	// ReExec starts the command through a re-exec of the calling program,
+	// which enters the target's namespaces from its main thread during
+	// package initialisation and then execs the command. The program must
+	// import this package, and Path must be absolute or found in PATH.
+	ReExec bool
+
+	pid   int
+	types []string
+}
+
+// NewNsenterCmd returns a command that runs name with args in the given
+// namespaces of pid. The namespace files are opened right away, so the
+// command still reaches them if pid exits before Start.
+func NewNsenterCmd(pid int, types []string, name string, args ...string) (*NsenterCmd, error) {
+	fds, err := OpenNamespaceFds(pid, types)
+	if err != nil {
+		return nil, err
+	}
+	return &NsenterCmd{Cmd: exec.Command(name, args...), NsFds: fds, pid: pid, types: types}, nil
+}
+
+func closeAll(fds map[string]*os.File) {
+	for _, f := range fds {
+		f.Close()
+	}
+}
+
+// Close releases the namespace files. They are only needed until Start.
+func (c *NsenterCmd) Close() {
+	closeAll(c.NsFds)
+}
+
+// Start enters the namespaces on a dedicated thread and starts the command
+// from there, or starts the trampoline if ReExec is set.
+func (c *NsenterCmd) Start() error {
+	if c.ReExec {
+		return c.startReExec()
+	}
+	errc := make(chan error, 1)
+	go func() {
+		// Never unlocked: the thread is in other namespaces now.
+		runtime.LockOSThread()
+		for _, nsType := range enterOrder {
+			f, ok := c.NsFds[nsType]
+			if !ok {
+				continue
+			}
+			if err := setnsFd(context.Background(), nil, int(f.Fd()), 0, nsType, NamespaceTypes[nsType]); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- c.Cmd.Start()
+	}()
+	return <-errc
+}
+
+// Run starts the command in the namespaces and waits for it.
+func (c *NsenterCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the command and returns its standard output. As with
+// exec.Cmd.Output, captured stderr is attached to an *exec.ExitError.
+func (c *NsenterCmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	captureErr := c.Stderr == nil
+	if captureErr {
+		c.Stderr = &stderr
+	}
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if captureErr && errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its standard output and
+// standard error interleaved.
+func (c *NsenterCmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	if c.Stderr != nil {
+		return nil, errors.New("exec: Stderr already set")
+	}
+	var b bytes.Buffer
+	c.Stdout = &b
+	c.Stderr = &b
+	err := c.Run()
+	return b.Bytes(), err
+}
+
+// NewNsenterCommand returns an unstarted *exec.Cmd that runs the command of
+// config in its namespaces. It is the re-exec trampoline of ReExec packaged
+// as a plain exec.Cmd: Path is /proc/self/exe and Env tells the trampoline
+// which namespace files to join and what to exec, so Start may be called
+// from any goroutine. The caller may change Stdin, Stdout, Stderr,
+// ExtraFiles and SysProcAttr or add to Env before calling Start itself; the
+// program must import this package.
+//
+// The namespace files are resolved now but opened by the trampoline, so a
+// target that exits before Start is not reached. Dir, the directory to run
+// in, is taken inside the entered mount namespace like NsenterConfig.Dir;
+// cmd.Dir instead applies before any namespace is joined. Credential is
+// switched to once inside. The pid namespace is entered with a fork, as Run
+// does, unless NoFork is set; the caller then waits for the trampoline,
+// which passes on the command's exit status. Setsid and Setpgid are applied
+// to the trampoline. Settings that need nsenter to act on the command from
+// outside, or on the thread after the namespaces are entered, are not
+// supported and make NewNsenterCommand fail, as do AuditLog and the other
+// settings about how nsenter itself enters. As with ReExec, a user
+// namespace cannot be joined, and asking for one is an error.
+func NewNsenterCommand(config *NsenterConfig) (*exec.Cmd, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	var unsupported []string
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"Unshare", len(config.Unshare) > 0},
+		{"Timeout", config.Timeout > 0},
+		{"TargetDir", config.TargetDir},
+		{"Chroot", config.Chroot != ""},
+		{"PivotRoot", config.PivotRoot != ""},
+		{"RemountSys", config.RemountSys},
+		{"UidMappings", len(config.UidMappings) > 0},
+		{"GidMappings", len(config.GidMappings) > 0},
+		{"AmbientCaps", len(config.AmbientCaps) > 0},
+		{"SeccompProfile", config.SeccompProfile != ""},
+		{"NoNewPrivs", config.NoNewPrivs},
+		{"SkipSameNs", config.SkipSameNs},
+		{"PreflightCheck", config.PreflightCheck},
+		{"PreserveCredentials", config.PreserveCredentials},
+		{"RestoreAfter", config.RestoreAfter},
+		{"UseCache", config.UseCache},
+		{"AuditLog", config.AuditLog != nil},
+	} {
+		if setting.set {
+			unsupported = append(unsupported, setting.name)
+		}
+	}
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("NewNsenterCommand does not support %s", strings.Join(unsupported, ", "))
+	}
+	if config.has("user") {
+		return nil, newNsError("setns", config.nsPid("user"), "user", fmt.Errorf("%w: the trampoline is already multithreaded", ErrUnsupportedNamespace))
+	}
+
+	cmd := exec.Command(config.Command, config.Args...)
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+	var paths []string
+	for _, nsType := range enterOrder {
+		if config.has(nsType) {
+			paths = append(paths, nsType+"="+config.nsPath(nsType))
+		}
+	}
+	env := append(config.environ(),
+		initEnv+"=1",
+		nsPathsEnv+"="+strings.Join(paths, "\n"),
+		pathEnv+"="+cmd.Path,
+	)
+	if config.Dir != "" {
+		env = append(env, dirEnv+"="+config.Dir)
+	}
+	if cred := config.Credential; cred != nil {
+		ids := []string{strconv.Itoa(int(cred.Uid)), strconv.Itoa(int(cred.Gid))}
+		for _, g := range cred.Groups {
+			ids = append(ids, strconv.Itoa(int(g)))
+		}
+		env = append(env, credEnv+"="+strings.Join(ids, ","))
+	}
+	if config.NoFork {
+		env = append(env, noForkEnv+"=1")
+	}
+	cmd.Path = "/proc/self/exe"
+	cmd.Env = env
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: config.Setsid, Setpgid: config.Setpgid}
+	if config.Setsid {
+		if _, err := unix.IoctlGetTermios(config.Ctty, unix.TCGETS); err == nil {
+			cmd.SysProcAttr.Setctty = true
+			cmd.SysProcAttr.Ctty = config.Ctty
+		}
+	}
+	return cmd, nil
+}
@@ -0,0 +1,119 @@
+package ns
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// nsID identifies a namespace by the device and inode of its nsfs file.
+type nsID struct {
+	dev, ino uint64
+}
+
+func statNs(path string) (nsID, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return nsID{}, fmt.Errorf("stat %s: %w", path, err)
+	}
+	return nsID{dev: uint64(st.Dev), ino: st.Ino}, nil
+}
+
+// SharesNamespace reports whether pid1 and pid2 are in the same nsType
+// namespace.
+func SharesNamespace(pid1, pid2 int, nsType string) (bool, error) {
+	a, err := statNs(NsPath(pid1, nsType))
+	if err != nil {
+		return false, err
+	}
+	b, err := statNs(NsPath(pid2, nsType))
+	if err != nil {
+		return false, err
+	}
+	return a == b, nil
+}
+
+// SameNamespaceAs reports, for each of types, whether the calling thread is
+// already in the same namespace as targetPID.
+func SameNamespaceAs(targetPID int, types []string) (map[string]bool, error) {
+	same := make(map[string]bool, len(types))
+	for _, nsType := range types {
+		self, err := statNs("/proc/thread-self/ns/" + nsType)
+		if err != nil {
+			return nil, err
+		}
+		target, err := statNs(NsPath(targetPID, nsType))
+		if err != nil {
+			return nil, err
+		}
+		same[nsType] = self == target
+	}
+	return same, nil
+}
+
+// alreadyIn reports whether setns into the configured nsType namespace
+// would leave the calling thread where it is. For pid and time namespaces,
+// which setns only applies to children, that means comparing against the
+// thread's *_for_children namespace.
+func (c *NsenterConfig) alreadyIn(nsType string) (bool, error) {
+	self := "/proc/thread-self/ns/" + nsType
+	if nsType == "pid" || nsType == "time" {
+		self += "_for_children"
+	}
+	a, err := statNs(self)
+	if err != nil {
+		return false, err
+	}
+	b, err := statNs(c.nsPath(nsType))
+	if err != nil {
+		return false, newNsError("open", c.nsPid(nsType), nsType, err)
+	}
+	return a == b, nil
+}
+
+// NsDiffEntry compares one namespace type of two processes. An inode is 0
+// if that process has no such namespace.
+type NsDiffEntry struct {
+	Type           string
+	Inode1, Inode2 uint64
+	Same           bool
+}
+
+// NsDiff compares every namespace listed under /proc/PID/ns of pid1 and
+// pid2, keyed by type, so it shows at a glance which namespaces two
+// supposedly isolated processes actually share.
+func NsDiff(pid1, pid2 int) (map[string]NsDiffEntry, error) {
+	var infos [2][]NsInfo
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, pid := range []int{pid1, pid2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			infos[i], errs[i] = ListNamespaces(pid)
+		}()
+	}
+	wg.Wait()
+	for i, pid := range []int{pid1, pid2} {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("diff namespaces of pid %d: %w", pid, errs[i])
+		}
+	}
+
+	diff := map[string]NsDiffEntry{}
+	for _, info := range infos[0] {
+		diff[info.Type] = NsDiffEntry{Type: info.Type, Inode1: info.Inode}
+	}
+	for _, info := range infos[1] {
+		e := diff[info.Type]
+		e.Type = info.Type
+		e.Inode2 = info.Inode
+		diff[info.Type] = e
+	}
+	for nsType, e := range diff {
+		e.Same = e.Inode1 != 0 && e.Inode1 == e.Inode2
+		diff[nsType] = e
+	}
+	return diff, nil
+}
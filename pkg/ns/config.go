@@ -0,0 +1,755 @@
+package ns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sys/unix"
+)
+
+// enterOrder is the order in which Run enters namespaces. The user namespace
+// comes first so that its capabilities apply to the rest, and the pid
+// namespace comes last because it only takes effect for children.
+var enterOrder = []string{"user", "uts", "ipc", "net", "cgroup", "time", "mnt", "pid"}
+
+// NsenterConfig describes a command to run inside the namespaces of a
+// target process.
+type NsenterConfig struct {
+	Pid        int
+	Command    string
+	Args       []string
+	Namespaces []string
+	// NsPaths maps namespace types to pinned namespace files that are
+	// entered instead of the ones of Pid.
+	NsPaths map[string]string
+	// NsTargets maps namespace types to processes whose namespace is
+	// entered instead of the one of Pid, so for example the network of one
+	// container can be combined with the filesystem of another. NsPaths
+	// takes precedence.
+	NsTargets map[string]int
+	// Timeout bounds how long the command may run. When set the command is
+	// always forked so nsenter can stop it: it gets SIGTERM on expiry and
+	// SIGKILL killGrace later.
+	Timeout time.Duration
+	// Env holds KEY=VALUE pairs set for the command, overriding inherited
+	// ones. With ClearEnv the command gets only Env, like env -i.
+	Env      []string
+	ClearEnv bool
+	// UnsetEnv names inherited variables to drop, such as LD_LIBRARY_PATH,
+	// that may not make sense in the target mount namespace.
+	UnsetEnv []string
+	// Dir is the directory to run the command in, resolved inside the
+	// entered mount namespace. TargetDir instead uses the target's own
+	// working directory. Both are applied after the namespaces are entered,
+	// because joining a mount namespace resets the working directory.
+	Dir       string
+	TargetDir bool
+	// PivotRoot, if set, is a directory that becomes the command's root
+	// through PivotRoot, once the namespaces are entered. It is done in a
+	// private copy of the mount namespace, so the target keeps its root.
+	// Dir is then taken inside the new root.
+	PivotRoot string
+	// Chroot, if set, is a directory of the entered mount namespace that
+	// becomes the command's root through chroot(2). It happens right after
+	// joining the mount namespace and before the pid namespace, whose file
+	// is opened while the target's /proc is still reachable. Dir is taken
+	// inside the new root.
+	Chroot string
+	// RemountSys mounts a fresh /sys, and /sys/fs/cgroup, once the
+	// namespaces are entered, so they show the entered network and cgroup
+	// namespaces; see RemountSys. Like PivotRoot it works in a private copy
+	// of the mount namespace and leaves the target's mounts alone.
+	RemountSys bool
+	// PreflightCheck checks for the needed capabilities before any setns,
+	// naming what is missing instead of failing with a bare EPERM. It is
+	// skipped when entering a user namespace, which grants its own.
+	PreflightCheck bool
+	// UidMappings and GidMappings are written to the target's still
+	// unmapped user namespace before it is entered.
+	UidMappings []UidMapping
+	GidMappings []GidMapping
+	// SeccompProfile is the path of an OCI seccomp profile to confine the
+	// command with. See LoadSeccompProfile for what is supported.
+	SeccompProfile string
+	// NoNewPrivs sets no_new_privs for the command, so setuid and file
+	// capability bits no longer grant privileges on exec. Entering a user
+	// namespace does not imply it.
+	NoNewPrivs bool
+	// RestoreAfter returns the thread that entered the namespaces to its
+	// original ones once the command has been started, or when Run fails
+	// before exec. A thread that could not be fully restored, that entered
+	// the mount namespace or that was restricted with NoNewPrivs or a
+	// seccomp filter, is discarded instead.
+	RestoreAfter bool
+	// Unshare lists namespace types to create afresh for the command, like
+	// unshare(1), instead of entering those of a target. The command is
+	// always forked, and a new mount namespace has its mounts made private
+	// as unshare(1) does. Settings applied from nsenter's own thread, such
+	// as SeccompProfile and Chroot, cannot be combined with it.
+	Unshare []string
+	// SkipSameNs leaves out every namespace the calling thread is already
+	// in, comparing inodes first, so entering is idempotent and an
+	// unchanged mount namespace is not unshared for nothing.
+	SkipSameNs bool
+	// Credential, if set, is the user and groups the command runs as. They
+	// must be mapped in the user namespace the command ends up in.
+	Credential *syscall.Credential
+	// AmbientCaps are raised in the command's ambient set, see
+	// SetAmbientCaps, so it keeps them when running as the non-root user
+	// given by Credential.
+	AmbientCaps []uint
+	// Setsid runs the command as the leader of a new session, with Ctty as
+	// its controlling terminal if that descriptor is a terminal; this is
+	// what a shell needs for job control. A session leader has to be a
+	// child, so Setsid implies forking. RunWithPTY always does this.
+	Setsid bool
+	Ctty   int
+	// Setpgid makes the command a process group leader. A forked command
+	// always gets a group of its own, so this only changes the exec path.
+	Setpgid bool
+	// NoFork execs the command in place even when the pid namespace is
+	// entered, saving the fork. setns only moves future children into a
+	// pid namespace, so the command itself stays in nsenter's: it is not
+	// PID 1 there, its getpid and the PIDs it reads from /proc are those
+	// of the outer namespace, and only processes it forks end up in the
+	// target's. The other namespaces are joined as usual. It cannot be
+	// combined with Timeout or Setsid, which need a child.
+	NoFork bool
+	// PreserveCredentials wraps entering the namespaces and switching to
+	// Credential in PreserveCapabilities, so the setup that follows keeps
+	// the effective capabilities nsenter started with.
+	PreserveCredentials bool
+	// UseCache remembers, per OS thread, which namespace of each type it
+	// last entered, and skips setns when asked to enter the same one again.
+	// It pays off when a locked thread enters the same namespaces in a loop.
+	UseCache bool
+	// RetryPolicy governs retrying setns on EAGAIN; the zero value gives
+	// the defaults described at RetryPolicy.
+	RetryPolicy RetryPolicy
+	// Tracer, if set, records Run as an nsenter.Run span with a child span
+	// for each namespace entered.
+	Tracer trace.Tracer
+	// AuditLog, if set, records every namespace transition Run makes,
+	// successful or not. Run does not close it.
+	AuditLog *AuditLogger
+	// Logger, if set, receives a debug record for every file opened and
+	// syscall made while entering the namespaces and starting the command.
+	Logger *slog.Logger
+}
+
+// killGrace is how long a timed-out child has to exit after SIGTERM.
+const killGrace = 5 * time.Second
+
+// NsenterOption configures an NsenterConfig.
+type NsenterOption func(*NsenterConfig)
+
+// NewNsenterConfig returns a config targeting pid with opts applied.
+func NewNsenterConfig(pid int, opts ...NsenterOption) *NsenterConfig {
+	c := &NsenterConfig{Pid: pid}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithCommand sets the command to run and its arguments.
+func WithCommand(command string, args ...string) NsenterOption {
+	return func(c *NsenterConfig) {
+		c.Command = command
+		c.Args = args
+	}
+}
+
+// WithNamespace adds the nsType namespace to the set to enter.
+func WithNamespace(nsType string) NsenterOption {
+	return func(c *NsenterConfig) {
+		if !slices.Contains(c.Namespaces, nsType) {
+			c.Namespaces = append(c.Namespaces, nsType)
+		}
+	}
+}
+
+// WithNsPath enters the nsType namespace pinned at path instead of the one
+// of the target process.
+func WithNsPath(nsType, path string) NsenterOption {
+	return func(c *NsenterConfig) {
+		WithNamespace(nsType)(c)
+		if c.NsPaths == nil {
+			c.NsPaths = make(map[string]string)
+		}
+		c.NsPaths[nsType] = path
+	}
+}
+
+// WithNsTarget enters the nsType namespace of pid instead of the one of the
+// target process.
+func WithNsTarget(nsType string, pid int) NsenterOption {
+	return func(c *NsenterConfig) {
+		WithNamespace(nsType)(c)
+		if c.NsTargets == nil {
+			c.NsTargets = make(map[string]int)
+		}
+		c.NsTargets[nsType] = pid
+	}
+}
+
+// WithUserNs enters the user namespace.
+func WithUserNs() NsenterOption { return WithNamespace("user") }
+
+// WithMountNs enters the mount namespace.
+func WithMountNs() NsenterOption { return WithNamespace("mnt") }
+
+// WithUtsNs enters the UTS namespace.
+func WithUtsNs() NsenterOption { return WithNamespace("uts") }
+
+// WithNetNs enters the network namespace.
+func WithNetNs() NsenterOption { return WithNamespace("net") }
+
+// WithIpcNs enters the IPC namespace.
+func WithIpcNs() NsenterOption { return WithNamespace("ipc") }
+
+// WithPidNs enters the PID namespace. The command is then forked rather
+// than exec'd, since only children join the new PID namespace.
+func WithPidNs() NsenterOption { return WithNamespace("pid") }
+
+// WithCgroupNs enters the cgroup namespace.
+func WithCgroupNs() NsenterOption { return WithNamespace("cgroup") }
+
+// WithTimeNs enters the time namespace.
+func WithTimeNs() NsenterOption { return WithNamespace("time") }
+
+func (c *NsenterConfig) has(nsType string) bool {
+	return slices.Contains(c.Namespaces, nsType)
+}
+
+// nsPath returns the file to open for the nsType namespace.
+func (c *NsenterConfig) nsPath(nsType string) string {
+	if path, ok := c.NsPaths[nsType]; ok {
+		return path
+	}
+	return NsPath(c.nsPid(nsType), nsType)
+}
+
+// nsPid returns the process whose nsType namespace is entered: the one in
+// NsTargets, else Pid. It is 0 if the namespace comes from NsPaths.
+func (c *NsenterConfig) nsPid(nsType string) int {
+	if _, ok := c.NsPaths[nsType]; ok {
+		return 0
+	}
+	if pid := c.NsTargets[nsType]; pid > 0 {
+		return pid
+	}
+	return c.Pid
+}
+
+// cwdPid returns the process whose working directory TargetDir uses: the
+// one whose mount namespace is entered, if that is not Pid.
+func (c *NsenterConfig) cwdPid() int {
+	if pid := c.NsTargets["mnt"]; pid > 0 {
+		return pid
+	}
+	return c.Pid
+}
+
+func (c *NsenterConfig) setnsOptions() *setnsOptions {
+	opts := &setnsOptions{logger: c.Logger, retry: c.RetryPolicy, cache: c.UseCache, audit: c.AuditLog}
+	if c.AuditLog != nil {
+		opts.command = append([]string{c.Command}, c.Args...)
+	}
+	return opts
+}
+
+// enter joins the nsType namespace from NsPaths, NsTargets or Pid.
+func (c *NsenterConfig) enter(ctx context.Context, nsType string) error {
+	return c.traced(ctx, nsType, func(ctx context.Context) error {
+		return enterPath(ctx, c.setnsOptions(), c.nsPath(nsType), c.nsPid(nsType), nsType)
+	})
+}
+
+// Run enters the configured namespaces and runs the command. Without a pid
+// namespace the current process is replaced and Run only returns on error.
+func (c *NsenterConfig) Run() error {
+	return c.RunContext(context.Background())
+}
+
+// RunContext is like Run but stops entering namespaces once ctx is done. A
+// forked child is killed if ctx is done before it exits.
+func (c *NsenterConfig) RunContext(ctx context.Context) (err error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var span trace.Span
+	if c.Tracer != nil {
+		ctx, span = c.Tracer.Start(ctx, "nsenter.Run", trace.WithAttributes(
+			attribute.Int("pid", c.Pid),
+			attribute.String("command", c.Command),
+		))
+		defer func() { endSpan(span, err) }()
+	}
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if len(c.Unshare) > 0 {
+		return c.runUnshared(ctx)
+	}
+
+	seccomp, err := c.loadSeccomp()
+	if err != nil {
+		return err
+	}
+
+	// PID namespace has to be last and has to have the fork. setns only
+	// sets the namespace for our future children, so a plain fork is what
+	// puts the command in it; CLONE_NEWPID would nest a fresh one instead.
+	if c.forks() {
+		cmd := c.command(ctx)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		ch := newChild(cmd)
+		if err := c.startInNamespaces(ctx, seccomp, cmd.Start); err != nil {
+			ch.stop()
+			return err
+		}
+		if err := ch.wait(); err != nil {
+			return c.childError(ctx, err)
+		}
+		return nil
+	}
+
+	runtime.LockOSThread() // Critical: required for setns to work correctly
+	defer runtime.UnlockOSThread()
+	if c.UseCache {
+		// Only reached if exec failed, after which the thread is elsewhere.
+		defer forgetThread()
+	}
+
+	if c.RestoreAfter {
+		snap, err := SaveNamespaces(c.Namespaces)
+		if err != nil {
+			return err
+		}
+		defer snap.Close()
+		// Only reached if exec failed.
+		defer snap.Restore()
+	}
+
+	if err := c.preserveCaps(func() error {
+		if err := c.enterNamespaces(ctx); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(c.AmbientCaps) > 0 {
+			// Keep the permitted set across setuid; ambient capabilities
+			// can only be raised from it.
+			if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+				return fmt.Errorf("set keepcaps: %w", err)
+			}
+		}
+		if err := c.setCredential(); err != nil {
+			return err
+		}
+		return SetAmbientCaps(c.AmbientCaps)
+	}); err != nil {
+		return err
+	}
+	if err := c.restrictThread(seccomp); err != nil {
+		return err
+	}
+
+	if c.Setpgid {
+		if err := unix.Setpgid(0, 0); err != nil {
+			return fmt.Errorf("setpgid: %w", err)
+		}
+	}
+
+	// Replace the current process if no pid ns involved
+	argv := append([]string{c.Command}, c.Args...)
+	logDebug(c.Logger, "execve", "path", c.Command, "argv", argv)
+	if c.Tracer != nil {
+		// A successful exec never returns to end it.
+		span.End()
+	}
+	if err := unix.Exec(c.Command, argv, c.environ()); err != nil {
+		return fmt.Errorf("exec %s: %w", c.Command, err)
+	}
+	return nil
+}
+
+// forks reports whether Run starts the command as a child rather than
+// exec'ing it in place.
+func (c *NsenterConfig) forks() bool {
+	return (c.has("pid") && !c.NoFork) || c.Timeout > 0 || c.Setsid
+}
+
+// startInNamespaces enters the namespaces on a dedicated OS thread, applies
+// restrictThread there, and calls start on that thread so the child is
+// forked from it.
+//
+// Unless RestoreAfter brings it back, the thread is never unlocked: once it
+// has joined other namespaces or is restricted it must not run other
+// goroutines, so it exits along with the goroutine.
+func (c *NsenterConfig) startInNamespaces(ctx context.Context, seccomp *unix.SockFprog, start func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if c.UseCache {
+			// The thread is either restored or thrown away.
+			defer forgetThread()
+		}
+		if c.RestoreAfter {
+			snap, err := SaveNamespaces(c.Namespaces)
+			if err != nil {
+				errc <- err
+				return
+			}
+			defer snap.Close()
+			defer func() {
+				if snap.Restore() == nil && seccomp == nil && !c.NoNewPrivs && reusable(c.Namespaces) {
+					runtime.UnlockOSThread()
+				}
+			}()
+		}
+		errc <- c.startOnThread(ctx, seccomp, start)
+	}()
+	return <-errc
+}
+
+func (c *NsenterConfig) startOnThread(ctx context.Context, seccomp *unix.SockFprog, start func() error) error {
+	if err := c.preserveCaps(func() error { return c.enterNamespaces(ctx) }); err != nil {
+		return err
+	}
+	if err := c.restrictThread(seccomp); err != nil {
+		return err
+	}
+	startTime := time.Now()
+	err := start()
+	logDebug(c.Logger, "fork", "path", c.Command, "args", c.Args, "err", err, "elapsed", time.Since(startTime))
+	return err
+}
+
+// preserveCaps runs fn, through PreserveCapabilities if PreserveCredentials
+// is set.
+func (c *NsenterConfig) preserveCaps(fn func() error) error {
+	if !c.PreserveCredentials {
+		return fn()
+	}
+	return PreserveCapabilities(fn)
+}
+
+// chroot changes the calling thread's root to Chroot, if set. The thread
+// gets its own fs state first, which joining a mount namespace already
+// gave it, so the rest of the process keeps its root.
+func (c *NsenterConfig) chroot() error {
+	if c.Chroot == "" {
+		return nil
+	}
+	if err := unix.Unshare(unix.CLONE_FS); err != nil {
+		return fmt.Errorf("chroot: unshare fs: %w", err)
+	}
+	err := unix.Chroot(c.Chroot)
+	logDebug(c.Logger, "chroot", "path", c.Chroot, "err", err)
+	if err != nil {
+		return fmt.Errorf("chroot %s: %w", c.Chroot, err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return fmt.Errorf("chroot: change directory to /: %w", err)
+	}
+	return nil
+}
+
+// pivotRoot switches to PivotRoot in a private copy of the current mount
+// namespace. Mounts are made slaves rather than private so that the copy
+// still sees mounts the target makes later, as with --mount-proc.
+func (c *NsenterConfig) pivotRoot() error {
+	if err := c.privateMountNs("pivot root"); err != nil {
+		return err
+	}
+	start := time.Now()
+	err := PivotRoot(c.PivotRoot, ".pivot_root")
+	logDebug(c.Logger, "pivot_root", "path", c.PivotRoot, "err", err, "elapsed", time.Since(start))
+	return err
+}
+
+// remountSys applies RemountSys, in the private mount namespace pivotRoot
+// made if it ran, or in one of its own.
+func (c *NsenterConfig) remountSys() error {
+	if c.PivotRoot == "" {
+		if err := c.privateMountNs("remount /sys"); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	err := RemountSys()
+	logDebug(c.Logger, "mount", "path", "/sys", "err", err, "elapsed", time.Since(start))
+	return err
+}
+
+// privateMountNs moves the thread to a copy of its mount namespace whose
+// mounts are slaves of the original's, for what to say in errors.
+func (c *NsenterConfig) privateMountNs(what string) error {
+	start := time.Now()
+	err := unix.Unshare(unix.CLONE_NEWNS)
+	logDebug(c.Logger, "unshare", "flags", "CLONE_NEWNS", "err", err, "elapsed", time.Since(start))
+	if err != nil {
+		return fmt.Errorf("%s: unshare mount namespace: %w", what, err)
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+		return fmt.Errorf("%s: make / slave: %w", what, err)
+	}
+	return nil
+}
+
+// restrictThread applies NoNewPrivs and the seccomp filter, if any, to the
+// calling thread. Both carry over to children and across execve; syscall
+// has no SysProcAttr equivalent for either.
+func (c *NsenterConfig) restrictThread(seccomp *unix.SockFprog) error {
+	if c.NoNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set no_new_privs: %w", err)
+		}
+	}
+	if seccomp != nil {
+		return installSeccomp(seccomp)
+	}
+	return nil
+}
+
+// loadSeccomp compiles SeccompProfile, if set. It is read before any
+// namespace is entered so the path refers to the caller's filesystem.
+func (c *NsenterConfig) loadSeccomp() (*unix.SockFprog, error) {
+	if c.SeccompProfile == "" {
+		return nil, nil
+	}
+	prog, err := LoadSeccompProfile(c.SeccompProfile)
+	if err != nil {
+		return nil, err
+	}
+	return &prog, nil
+}
+
+// environ returns the environment for the command.
+func (c *NsenterConfig) environ() []string {
+	var env []string
+	if !c.ClearEnv {
+		for _, kv := range os.Environ() {
+			key, _, _ := strings.Cut(kv, "=")
+			if !slices.Contains(c.UnsetEnv, key) {
+				env = append(env, kv)
+			}
+		}
+	}
+	for _, kv := range c.Env {
+		key, _, _ := strings.Cut(kv, "=")
+		env = slices.DeleteFunc(env, func(old string) bool {
+			return strings.HasPrefix(old, key+"=")
+		})
+		env = append(env, kv)
+	}
+	return env
+}
+
+// withTimeout derives a context that expires after c.Timeout, if set.
+func (c *NsenterConfig) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+// command builds the child command. Once ctx is done the child gets
+// SIGTERM, then SIGKILL if it is still running killGrace later.
+func (c *NsenterConfig) command(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, c.Command, c.Args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(unix.SIGTERM)
+	}
+	cmd.WaitDelay = killGrace
+	cmd.Env = c.environ()
+	cmd.SysProcAttr = &unix.SysProcAttr{Credential: c.Credential, Setsid: c.Setsid}
+	if c.Setsid {
+		if _, err := unix.IoctlGetTermios(c.Ctty, unix.TCGETS); err == nil {
+			cmd.SysProcAttr.Setctty = true
+			cmd.SysProcAttr.Ctty = c.Ctty
+		}
+	}
+	for _, capability := range c.AmbientCaps {
+		cmd.SysProcAttr.AmbientCaps = append(cmd.SysProcAttr.AmbientCaps, uintptr(capability))
+	}
+	return cmd
+}
+
+// childError wraps the error from waiting on the child, marking it as a
+// timeout if c.Timeout expired.
+func (c *NsenterConfig) childError(ctx context.Context, err error) error {
+	if c.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("command timed out after %v: %w", c.Timeout, context.DeadlineExceeded)
+	}
+	return fmt.Errorf("exec failed: %w", err)
+}
+
+// writeIdMaps sets up the target's user namespace in the order the kernel
+// requires: setgroups, then uid_map, then gid_map.
+func (c *NsenterConfig) writeIdMaps() error {
+	if len(c.GidMappings) > 0 {
+		if err := SetgroupsDeny(c.nsPid("user")); err != nil {
+			return err
+		}
+	}
+	if len(c.UidMappings) > 0 {
+		if err := WriteUidMap(c.nsPid("user"), c.UidMappings); err != nil {
+			return err
+		}
+	}
+	if len(c.GidMappings) > 0 {
+		if err := WriteGidMap(c.nsPid("user"), c.GidMappings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openPidNamespace opens the pid namespace to enter. The caller closes it.
+func (c *NsenterConfig) openPidNamespace() (*os.File, error) {
+	start := time.Now()
+	f, err := os.Open(c.nsPath("pid"))
+	logDebug(c.Logger, "open", "path", c.nsPath("pid"), "fd", fdOf(f), "err", err, "elapsed", time.Since(start))
+	if err != nil {
+		return nil, newNsError("open", c.nsPid("pid"), "pid", err)
+	}
+	return f, nil
+}
+
+// enterNamespaces moves the calling thread into the configured namespaces in
+// enterOrder, then changes to the configured working directory. The caller
+// must hold runtime.LockOSThread and have checked c with validate.
+func (c *NsenterConfig) enterNamespaces(ctx context.Context) error {
+	if c.PreflightCheck && !c.has("user") {
+		for _, nsType := range c.Namespaces {
+			if err := CheckSetnsCapability(nsType); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.has("user") {
+		if err := c.writeIdMaps(); err != nil {
+			return err
+		}
+	}
+
+	// Hold on to the target's cwd now: once in its pid and mount namespaces
+	// /proc may no longer know it by the same PID.
+	var targetCwd *os.File
+	if c.TargetDir {
+		f, err := os.Open(fmt.Sprintf("/proc/%d/cwd", c.cwdPid()))
+		if err != nil {
+			return fmt.Errorf("open target working directory: %w", err)
+		}
+		defer f.Close()
+		targetCwd = f
+	}
+
+	skip := map[string]bool{}
+	if c.SkipSameNs {
+		for _, nsType := range c.Namespaces {
+			same, err := c.alreadyIn(nsType)
+			if err != nil {
+				return err
+			}
+			if same {
+				logDebug(c.Logger, "skip", "nstype", cloneNames[nsType], "reason", "already in namespace")
+				skip[nsType] = true
+			}
+		}
+	}
+
+	var pidFD *os.File
+	chrooted := false
+	for _, nsType := range enterOrder {
+		if !c.has(nsType) || skip[nsType] {
+			continue
+		}
+		switch nsType {
+		case "mnt":
+			// If we switch our mnt namespace, entering the pid namespace will
+			// only work if we open our file descriptor first.
+			if c.has("pid") {
+				f, err := c.openPidNamespace()
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				pidFD = f
+			}
+			if err := c.enter(ctx, "mnt"); err != nil {
+				return err
+			}
+			if err := c.chroot(); err != nil {
+				return err
+			}
+			chrooted = true
+		case "pid":
+			if pidFD == nil {
+				if err := c.enter(ctx, "pid"); err != nil {
+					return err
+				}
+				break
+			}
+			err := c.traced(ctx, "pid", func(ctx context.Context) error {
+				return setnsFd(ctx, c.setnsOptions(), int(pidFD.Fd()), c.nsPid("pid"), "pid", NamespaceTypes["pid"])
+			})
+			if err != nil {
+				return err
+			}
+		default:
+			if err := c.enter(ctx, nsType); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !chrooted {
+		if err := c.chroot(); err != nil {
+			return err
+		}
+	}
+	if c.PivotRoot != "" {
+		if err := c.pivotRoot(); err != nil {
+			return err
+		}
+	}
+	if c.RemountSys {
+		if err := c.remountSys(); err != nil {
+			return err
+		}
+	}
+
+	// The thread has its own fs state after joining a mount namespace, so
+	// changing directory here does not move other threads.
+	switch {
+	case targetCwd != nil:
+		if err := unix.Fchdir(int(targetCwd.Fd())); err != nil {
+			return fmt.Errorf("change to target working directory: %w", err)
+		}
+	case c.Dir != "":
+		if err := unix.Chdir(c.Dir); err != nil {
+			return fmt.Errorf("change directory to %s: %w", c.Dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package ns_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"bustakube.com/nsenter/pkg/ns"
+	"bustakube.com/nsenter/pkg/ns/nstest"
+)
+
+// Environment of the test binary run again as a helper process.
+const (
+	// helperEnv says what the helper process is for.
+	helperEnv = "NSENTER_TEST_HELPER"
+	// configEnv holds the NsenterConfig, as JSON, for a "run" helper.
+	configEnv = "NSENTER_TEST_CONFIG"
+)
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(helperEnv) {
+	case "run":
+		os.Exit(runHelper())
+	case "userns":
+		os.Exit(userNsHelper())
+	case "raw-socket":
+		os.Exit(rawSocketHelper())
+	}
+	os.Exit(m.Run())
+}
+
+// runHelper runs the config of configEnv. Run replaces the process with
+// the command unless it forks, so that is what the caller ends up seeing.
+func runHelper() int {
+	var c ns.NsenterConfig
+	err := json.Unmarshal([]byte(os.Getenv(configEnv)), &c)
+	os.Unsetenv(helperEnv)
+	os.Unsetenv(configEnv)
+	if err == nil {
+		err = c.Run()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ns.ExitCode(err)
+	}
+	return 0
+}
+
+// userNsHelper reports, by its exit status, whether the process may
+// create a user namespace.
+func userNsHelper() int {
+	cmd := exec.Command("true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWUSER}
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// rawSocketHelper reports, by its exit status, whether the process may
+// open a raw socket, which takes CAP_NET_RAW.
+func rawSocketHelper() int {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_RAW, unix.IPPROTO_ICMP)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "socket:", err)
+		return 1
+	}
+	unix.Close(fd)
+	return 0
+}
+
+// helperCommand returns a helper process that runs c.
+func helperCommand(t *testing.T, c *ns.NsenterConfig) *exec.Cmd {
+	t.Helper()
+	config, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), helperEnv+"=run", configEnv+"="+string(config))
+	return cmd
+}
+
+// runConfig runs c in a helper process and returns the command's output,
+// stdout and stderr together, and the error waiting for it.
+func runConfig(t *testing.T, c *ns.NsenterConfig) (string, error) {
+	t.Helper()
+	out, err := helperCommand(t, c).CombinedOutput()
+	return string(out), err
+}
+
+// lookPath finds the executable name in PATH; Run execs the command's path
+// as given.
+func lookPath(t *testing.T, name string) string {
+	t.Helper()
+	path, err := exec.LookPath(name)
+	if err != nil {
+		t.Skip(err)
+	}
+	return path
+}
+
+// sharedTempDir returns a temporary directory that other users can reach,
+// for files a test uses as another user.
+func sharedTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		if err := os.Chmod(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// copyExecutable copies the executable at src into dir with the given
+// mode and returns the copy's path.
+func copyExecutable(t *testing.T, src, dir string, mode os.FileMode) string {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, filepath.Base(src))
+	if err := os.WriteFile(path, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// WriteFile's mode is subject to the umask and drops setuid.
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestNoNewPrivs runs a setuid-root copy of id(1) as nobody, which without
+// NoNewPrivs gets euid 0.
+func TestNoNewPrivs(t *testing.T) {
+	requireRoot(t)
+	id := copyExecutable(t, lookPath(t, "id"), sharedTempDir(t), os.ModeSetuid|0o755)
+	nobody := &syscall.Credential{Uid: 65534, Gid: 65534}
+
+	euid := func(noNewPrivs bool) string {
+		out, err := runConfig(t, &ns.NsenterConfig{Command: id, Args: []string{"-u"}, Credential: nobody, NoNewPrivs: noNewPrivs})
+		if err != nil {
+			t.Fatalf("id -u: %v\n%s", err, out)
+		}
+		return strings.TrimSpace(out)
+	}
+	if got := euid(false); got != "0" {
+		t.Skipf("setuid bit not honoured here: id -u printed %s", got)
+	}
+	if got := euid(true); got != "65534" {
+		t.Errorf("with NoNewPrivs, the setuid id -u printed %s, want 65534", got)
+	}
+
+	out, err := runConfig(t, &ns.NsenterConfig{Command: lookPath(t, "cat"), Args: []string{"/proc/self/status"}, NoNewPrivs: true})
+	if err != nil {
+		t.Fatalf("cat /proc/self/status: %v\n%s", err, out)
+	}
+	if m := regexp.MustCompile(`(?m)^NoNewPrivs:\s*(\d+)$`).FindStringSubmatch(out); m == nil || m[1] != "1" {
+		t.Errorf("with NoNewPrivs, /proc/self/status has NoNewPrivs %v, want 1", m)
+	}
+}
+
+// TestPidNamespaceFork checks where the forked command lands: one pid
+// namespace below the test's, as PID 1 of a fresh one, or under the init
+// of an entered one, where a CLONE_NEWPID on the fork would have nested a
+// fresh namespace instead.
+func TestPidNamespaceFork(t *testing.T) {
+	if asRoot(t) {
+		return
+	}
+	own, err := ns.ParseProcStatus(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nsPid := regexp.MustCompile(`(?m)^NSpid:\s*(.*)$`)
+	for _, tt := range []struct {
+		name   string
+		config *ns.NsenterConfig
+		init   bool
+	}{
+		{"unshared", &ns.NsenterConfig{Unshare: []string{"pid"}}, true},
+		{"entered", ns.NewNsenterConfig(nstest.NewTestNamespace(t, "pid").(*ns.ProcNamespace).Pid, ns.WithPidNs()), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Command, tt.config.Args = lookPath(t, "cat"), []string{"/proc/self/status"}
+			out, err := runConfig(t, tt.config)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+			m := nsPid.FindStringSubmatch(out)
+			if m == nil {
+				t.Fatalf("no NSpid in /proc/self/status:\n%s", out)
+			}
+			pids := strings.Fields(m[1])
+			if len(pids) != len(own.NSpid)+1 {
+				t.Fatalf("command has NSpid %v, want one pid namespace below the test's %v", pids, own.NSpid)
+			}
+			if got := pids[len(pids)-1]; (got == "1") != tt.init {
+				t.Errorf("command has PID %s in its pid namespace; should be its init: %v", got, tt.init)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package ns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ContainerRuntimeResolver finds the init PID of a container.
+type ContainerRuntimeResolver interface {
+	ResolvePID(containerID string) (int, error)
+}
+
+// DockerResolver resolves containers with docker inspect.
+type DockerResolver struct{}
+
+// ContainerdResolver resolves containers with ctr task ls.
+type ContainerdResolver struct {
+	// Namespace is the containerd namespace, such as k8s.io. Empty means
+	// ctr's default.
+	Namespace string
+}
+
+// CrioResolver resolves containers with crictl inspect.
+type CrioResolver struct{}
+
+// runtimeSockets lists the sockets AutoDetectRuntime looks for, in the
+// order it tries them.
+var runtimeSockets = []struct {
+	path     string
+	resolver ContainerRuntimeResolver
+}{
+	{"/var/run/docker.sock", DockerResolver{}},
+	{"/run/containerd/containerd.sock", ContainerdResolver{}},
+	{"/var/run/crio/crio.sock", CrioResolver{}},
+}
+
+// AutoDetectRuntime returns a resolver for the first container runtime
+// whose socket exists.
+func AutoDetectRuntime() (ContainerRuntimeResolver, error) {
+	for _, rt := range runtimeSockets {
+		if _, err := os.Stat(rt.path); err == nil {
+			return rt.resolver, nil
+		}
+	}
+	return nil, errors.New("no container runtime found (looked for docker, containerd and CRI-O sockets); pass the container's PID with --target instead")
+}
+
+// RuntimeResolver returns the resolver for the runtime called name: docker,
+// containerd or crio. An empty name or "auto" calls AutoDetectRuntime.
+func RuntimeResolver(name string) (ContainerRuntimeResolver, error) {
+	switch name {
+	case "", "auto":
+		return AutoDetectRuntime()
+	case "docker":
+		return DockerResolver{}, nil
+	case "containerd":
+		return ContainerdResolver{}, nil
+	case "crio", "cri-o":
+		return CrioResolver{}, nil
+	}
+	return nil, fmt.Errorf("unknown container runtime %q (want docker, containerd or crio)", name)
+}
+
+// ResolvePid returns the init PID of the Docker container with the given
+// name or ID.
+func ResolvePid(containerID string) (int, error) {
+	return DockerResolver{}.ResolvePID(containerID)
+}
+
+// ResolvePID returns the init PID of the Docker container with the given
+// name or ID.
+func (DockerResolver) ResolvePID(containerID string) (int, error) {
+	out, err := runtimeOutput(containerID, "docker", "inspect", "--format", "{{.State.Pid}}", containerID)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("resolve container %s: unexpected docker output %q", containerID, out)
+	}
+	if pid <= 0 {
+		return 0, fmt.Errorf("resolve container %s: container is not running; start it with docker start %s", containerID, containerID)
+	}
+	return pid, nil
+}
+
+// ResolvePID returns the PID of the task of the containerd container with
+// the given ID.
+func (r ContainerdResolver) ResolvePID(containerID string) (int, error) {
+	var args []string
+	if r.Namespace != "" {
+		args = append(args, "--namespace", r.Namespace)
+	}
+	out, err := runtimeOutput(containerID, "ctr", append(args, "task", "ls")...)
+	if err != nil {
+		return 0, err
+	}
+
+	// ctr task ls prints a TASK PID STATUS table.
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != containerID {
+			continue
+		}
+		if fields[2] != "RUNNING" {
+			return 0, fmt.Errorf("resolve container %s: task is %s, not running", containerID, strings.ToLower(fields[2]))
+		}
+		pid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, fmt.Errorf("resolve container %s: unexpected ctr output %q", containerID, line)
+		}
+		return pid, nil
+	}
+	return 0, fmt.Errorf("resolve container %s: no containerd task with that ID; start it with ctr task start %s", containerID, containerID)
+}
+
+// ResolvePID returns the init PID of the CRI-O container with the given ID
+// or ID prefix.
+func (CrioResolver) ResolvePID(containerID string) (int, error) {
+	out, err := runtimeOutput(containerID, "crictl", "inspect", "--output", "json", containerID)
+	if err != nil {
+		return 0, err
+	}
+
+	var status struct {
+		Info struct {
+			Pid int `json:"pid"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(out, &status); err != nil {
+		return 0, fmt.Errorf("resolve container %s: unexpected crictl output: %w", containerID, err)
+	}
+	if status.Info.Pid <= 0 {
+		return 0, fmt.Errorf("resolve container %s: container is not running; start it with crictl start %s", containerID, containerID)
+	}
+	return status.Info.Pid, nil
+}
+
+// runtimeOutput runs a runtime's CLI and returns its standard output,
+// turning a failure into an error that names the container.
+func runtimeOutput(containerID, tool string, args ...string) ([]byte, error) {
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return nil, fmt.Errorf("resolve container %s: %s not found in PATH; pass the container's PID with --target instead", containerID, tool)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("resolve container %s: %s %s: %s", containerID, tool, subcommand(args), strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("resolve container %s: %w", containerID, err)
+	}
+	return out, nil
+}
+
+// subcommand returns the first argument that is not a flag or a flag value.
+func subcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") {
+			i++
+			continue
+		}
+		return args[i]
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package ns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// NamespacedDialer is a net.Dialer whose connections are made from inside
+// a network namespace. Once made, a connection keeps working from any
+// goroutine: a socket belongs to the namespace it was created in.
+//
+// A plain net.Dialer cannot be made to do this with its Control hook,
+// which runs after the socket has been created in the caller's namespace;
+// the socket itself has to be created on a thread inside the namespace.
+// Name resolution may still happen on other threads, in the caller's
+// namespace, so dial addresses that do not depend on the namespace's DNS.
+type NamespacedDialer struct {
+	net.Dialer
+	path string
+}
+
+// NewNamespacedDialer returns a dialer for the network namespace n.
+func NewNamespacedDialer(n Namespace) (*NamespacedDialer, error) {
+	nsType, err := nsTypeOf(n.Path())
+	if err != nil {
+		return nil, fmt.Errorf("namespaced dialer: %w", err)
+	}
+	if nsType != "net" {
+		return nil, fmt.Errorf("namespaced dialer: %s is a %s namespace, not a net namespace", n.Path(), nsType)
+	}
+	return &NamespacedDialer{path: n.Path()}, nil
+}
+
+// Dial is like net.Dialer.Dial but connects from inside the namespace.
+func (d *NamespacedDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext is like net.Dialer.DialContext but connects from inside the
+// namespace. Each call enters the namespace on its own locked thread and
+// restores the thread's original network namespace afterwards, so
+// concurrent dials, including into different namespaces, do not interfere.
+func (d *NamespacedDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	runtime.LockOSThread()
+
+	orig, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, newNsError("save", 0, "net", err)
+	}
+	defer orig.Close()
+	if err := EnterNamespaceByPath(d.path, "net"); err != nil {
+		runtime.UnlockOSThread()
+		return nil, err
+	}
+	defer func() {
+		// A thread that cannot get back stays locked and is discarded.
+		if unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET) == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+
+	return d.Dialer.DialContext(ctx, network, address)
+}
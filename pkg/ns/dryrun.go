@@ -0,0 +1,174 @@
+package ns
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DryRun writes the syscalls Run would make to w, one per line, without
+// making them. It still checks that the namespace files can be opened and
+// that the command exists, in the target's root if its mount namespace is
+// entered, so it catches the common mistakes without side effects.
+func (c *NsenterConfig) DryRun(w io.Writer) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	var plan []string
+	forked := c.forks()
+	if len(c.Unshare) > 0 {
+		if c.Pid > 0 || len(c.Namespaces) > 0 {
+			return fmt.Errorf("Unshare cannot be combined with entering a target's namespaces")
+		}
+		var names []string
+		for _, nsType := range c.Unshare {
+			if _, ok := NamespaceTypes[nsType]; !ok {
+				return newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+			}
+			names = append(names, cloneNames[nsType])
+		}
+		plan = append(plan, fmt.Sprintf("clone(%s)", strings.Join(names, "|")))
+		forked = true
+	}
+
+	for _, nsType := range c.Namespaces {
+		if _, ok := NamespaceTypes[nsType]; !ok {
+			return newNsError("lookup", c.Pid, nsType, ErrUnsupportedNamespace)
+		}
+		if _, ok := c.NsPaths[nsType]; !ok && c.nsPid(nsType) <= 0 {
+			return fmt.Errorf("no target process or path for %s namespace", nsType)
+		}
+	}
+	chrooted := false
+	for _, nsType := range enterOrder {
+		if !c.has(nsType) {
+			continue
+		}
+		if err := checkSupported(c.nsPid(nsType), nsType); err != nil {
+			return err
+		}
+		path := c.nsPath(nsType)
+		f, err := os.Open(path)
+		if err != nil {
+			return newNsError("open", c.nsPid(nsType), nsType, err)
+		}
+		f.Close()
+		if c.SkipSameNs {
+			same, err := c.alreadyIn(nsType)
+			if err != nil {
+				return err
+			}
+			if same {
+				continue
+			}
+		}
+		if nsType == "mnt" {
+			plan = append(plan, "unshare(CLONE_NEWNS)")
+		}
+		plan = append(plan, fmt.Sprintf("setns(open(%q), %s)", path, cloneNames[nsType]))
+		if nsType == "mnt" && c.Chroot != "" {
+			plan = append(plan, fmt.Sprintf("chroot(%q)", c.Chroot))
+			chrooted = true
+		}
+	}
+	if c.Chroot != "" {
+		if c.TargetDir || c.PivotRoot != "" {
+			return fmt.Errorf("Chroot cannot be combined with TargetDir or PivotRoot")
+		}
+		if !chrooted {
+			plan = append(plan, fmt.Sprintf("chroot(%q)", c.Chroot))
+		}
+	}
+
+	if c.PivotRoot != "" {
+		if c.TargetDir {
+			return fmt.Errorf("PivotRoot and TargetDir are mutually exclusive")
+		}
+		plan = append(plan, "unshare(CLONE_NEWNS)", fmt.Sprintf("pivot_root(%q, %q)", c.PivotRoot, filepath.Join(c.PivotRoot, ".pivot_root")))
+	}
+	if c.RemountSys {
+		if c.PivotRoot == "" {
+			plan = append(plan, "unshare(CLONE_NEWNS)")
+		}
+		plan = append(plan, `umount2("/sys", MNT_DETACH)`, `mount("sysfs", "/sys", "sysfs")`)
+	}
+	switch {
+	case c.TargetDir:
+		plan = append(plan, fmt.Sprintf("fchdir(open(%q))", fmt.Sprintf("/proc/%d/cwd", c.cwdPid())))
+	case c.Dir != "":
+		plan = append(plan, fmt.Sprintf("chdir(%q)", c.Dir))
+	}
+	if c.NoNewPrivs {
+		plan = append(plan, "prctl(PR_SET_NO_NEW_PRIVS, 1)")
+	}
+	if c.SeccompProfile != "" {
+		if _, err := LoadSeccompProfile(c.SeccompProfile); err != nil {
+			return err
+		}
+		plan = append(plan, fmt.Sprintf("seccomp(SECCOMP_SET_MODE_FILTER, load(%q))", c.SeccompProfile))
+	}
+
+	path, err := c.lookCommand(forked)
+	if err != nil {
+		return err
+	}
+	if forked && len(c.Unshare) == 0 {
+		plan = append(plan, "fork()")
+	}
+	argv := make([]string, 0, 1+len(c.Args))
+	for _, arg := range append([]string{c.Command}, c.Args...) {
+		argv = append(argv, fmt.Sprintf("%q", arg))
+	}
+	plan = append(plan, fmt.Sprintf("execve(%q, [%s], ...)", path, strings.Join(argv, ", ")))
+
+	for _, line := range plan {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookCommand finds the command the way Run would: a forked command is
+// searched for in PATH, an exec'd one is taken as a path. If the mount
+// namespace is entered the search happens under the target's root, since
+// that is where the command will be looked up. The returned path is as seen
+// from inside.
+func (c *NsenterConfig) lookCommand(searchPath bool) (string, error) {
+	if !c.has("mnt") || c.nsPid("mnt") <= 0 {
+		if !searchPath || strings.Contains(c.Command, "/") {
+			if _, err := os.Stat(c.Command); err != nil {
+				return "", fmt.Errorf("command %s: %w", c.Command, err)
+			}
+			return c.Command, nil
+		}
+		path, err := exec.LookPath(c.Command)
+		if err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+
+	root := fmt.Sprintf("/proc/%d/root", c.nsPid("mnt"))
+	candidates := []string{c.Command}
+	if searchPath && !strings.Contains(c.Command, "/") {
+		candidates = nil
+		for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+			candidates = append(candidates, filepath.Join(dir, c.Command))
+		}
+	}
+	for _, candidate := range candidates {
+		inside := candidate
+		if !filepath.IsAbs(inside) {
+			inside = filepath.Join(c.Dir, inside)
+		}
+		if st, err := os.Stat(filepath.Join(root, inside)); err == nil && !st.IsDir() && st.Mode()&0o111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("command %s not found in the target's mount namespace", c.Command)
+}
@@ -0,0 +1,66 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Sentinel errors reported by NsError. Test for them with errors.Is.
+var (
+	ErrPermission           = errors.New("permission denied")
+	ErrNoProcess            = errors.New("no such process")
+	ErrUnsupportedNamespace = errors.New("unsupported namespace")
+	ErrNamespaceGone        = errors.New("namespace no longer exists")
+	ErrTypeMismatch         = errors.New("namespace type mismatch")
+)
+
+// NsError records a failed operation on the NsType namespace of Pid.
+type NsError struct {
+	NsType string
+	Pid    int
+	Op     string
+	Err    error
+
+	kind error
+}
+
+func (e *NsError) Error() string {
+	if e.Pid > 0 {
+		return fmt.Sprintf("%s %s namespace of pid %d: %v", e.Op, e.NsType, e.Pid, e.Err)
+	}
+	return fmt.Sprintf("%s %s namespace: %v", e.Op, e.NsType, e.Err)
+}
+
+func (e *NsError) Unwrap() error { return e.Err }
+
+// Is reports whether target is the sentinel error describing e.
+func (e *NsError) Is(target error) bool {
+	return e.kind != nil && target == e.kind
+}
+
+// newNsError wraps err and classifies it against the sentinel errors.
+func newNsError(op string, pid int, nsType string, err error) *NsError {
+	e := &NsError{NsType: nsType, Pid: pid, Op: op, Err: err}
+	switch {
+	case errors.Is(err, ErrUnsupportedNamespace):
+		e.kind = ErrUnsupportedNamespace
+	case errors.Is(err, ErrTypeMismatch):
+		e.kind = ErrTypeMismatch
+	case errors.Is(err, unix.EPERM), errors.Is(err, unix.EACCES):
+		e.kind = ErrPermission
+	case errors.Is(err, unix.ESRCH):
+		e.kind = ErrNoProcess
+	case errors.Is(err, os.ErrNotExist):
+		// A missing ns entry under a live /proc/PID means the process is
+		// exiting or the kernel lacks that namespace type.
+		if _, statErr := os.Stat(fmt.Sprintf("/proc/%d", pid)); pid > 0 && statErr != nil {
+			e.kind = ErrNoProcess
+		} else {
+			e.kind = ErrNamespaceGone
+		}
+	}
+	return e
+}
@@ -0,0 +1,23 @@
+package ns
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ResolveExePath returns the path of the executable pid is running, read
+// from /proc/PID/exe. The path is as seen in pid's mount namespace, so it
+// is only meaningful after entering that namespace; from outside, exec
+// /proc/PID/exe itself. An executable that was deleted or replaced since
+// pid started has no path and gives an error.
+func ResolveExePath(pid int) (string, error) {
+	target, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return "", newNsError("resolve executable of", pid, "mnt", err)
+	}
+	if path, deleted := strings.CutSuffix(target, " (deleted)"); deleted {
+		return "", fmt.Errorf("executable %s of pid %d has been deleted; /proc/%d/exe still runs it", path, pid, pid)
+	}
+	return target, nil
+}
@@ -0,0 +1,11 @@
+package ns
+
+import "context"
+
+// EnterNamespaceByFdCached is EnterNamespaceByFd through the per-thread
+// cache of NsenterConfig.UseCache.
+func EnterNamespaceByFdCached(fd int, nsType string) error {
+	return setnsFd(context.Background(), &setnsOptions{cache: true}, fd, 0, nsType, NamespaceTypes[nsType])
+}
+
+var ForgetThread = forgetThread
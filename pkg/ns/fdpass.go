@@ -0,0 +1,273 @@
+package ns
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// SendNamespaceFds passes fds to the other end of conn in a single
+// SCM_RIGHTS message. The caller keeps its copies and may close them once
+// this returns.
+func SendNamespaceFds(conn *net.UnixConn, fds []*os.File) error {
+	raw := make([]int, len(fds))
+	for i, f := range fds {
+		raw[i] = int(f.Fd())
+	}
+	return sendFds(conn, []byte{0}, raw)
+}
+
+func sendFds(conn *net.UnixConn, data []byte, fds []int) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var oob []byte
+	if len(fds) > 0 {
+		oob = unix.UnixRights(fds...)
+	}
+	var sendErr error
+	err = rc.Write(func(fd uintptr) bool {
+		sendErr = unix.Sendmsg(int(fd), data, oob, nil, 0)
+		return sendErr != unix.EAGAIN
+	})
+	if err == nil {
+		err = sendErr
+	}
+	if err != nil {
+		return fmt.Errorf("send namespace fds: %w", err)
+	}
+	return nil
+}
+
+// ReceiveNamespaceFds reads a message sent by SendNamespaceFds and returns
+// the count files it carries.
+func ReceiveNamespaceFds(conn *net.UnixConn, count int) ([]*os.File, error) {
+	_, files, err := receiveFds(conn, 1, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) != count {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, fmt.Errorf("receive namespace fds: got %d, want %d", len(files), count)
+	}
+	return files, nil
+}
+
+// receiveFds reads one message of up to dataLen bytes carrying up to count
+// file descriptors.
+func receiveFds(conn *net.UnixConn, dataLen, count int) ([]byte, []*os.File, error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return nil, nil, err
+	}
+	data := make([]byte, dataLen)
+	oob := make([]byte, unix.CmsgSpace(count*4))
+	var n, oobn int
+	var recvErr error
+	err = rc.Read(func(fd uintptr) bool {
+		n, oobn, _, _, recvErr = unix.Recvmsg(int(fd), data, oob, unix.MSG_CMSG_CLOEXEC)
+		return recvErr != unix.EAGAIN
+	})
+	if err == nil {
+		err = recvErr
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("receive namespace fds: %w", err)
+	}
+	if n == 0 && oobn == 0 {
+		return nil, nil, fmt.Errorf("receive namespace fds: %w", syscall.ECONNRESET)
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, nil, fmt.Errorf("receive namespace fds: %w", err)
+	}
+	var files []*os.File
+	for _, msg := range msgs {
+		fds, err := unix.ParseUnixRights(&msg)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "nsfd"))
+		}
+	}
+	return data[:n], files, nil
+}
+
+// NamespaceFdServer hands out namespace file descriptors over a Unix
+// socket, so an unprivileged process can enter namespaces that only a
+// privileged one may open.
+//
+// A client sends one line "PID TYPE[,TYPE...]" per request; the server
+// answers with "ok" and the files in that order, or with "error: " and a
+// message and no files. RequestNamespaceFds implements the client side.
+type NamespaceFdServer struct {
+	// Authorize decides whether the client with the given credentials may
+	// have the nsType namespace of pid. If nil, clients may only have the
+	// namespaces of processes running as their own UID, or any if they are
+	// root.
+	Authorize func(cred *unix.Ucred, pid int, nsType string) error
+
+	listener *net.UnixListener
+}
+
+// NewNamespaceFdServer starts listening on the Unix socket at path.
+func NewNamespaceFdServer(path string) (*NamespaceFdServer, error) {
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("namespace fd server: %w", err)
+	}
+	return &NamespaceFdServer{listener: l}, nil
+}
+
+// Serve accepts clients until the server is closed, answering each on its
+// own goroutine. It returns nil after Close.
+func (s *NamespaceFdServer) Serve() error {
+	for {
+		conn, err := s.listener.AcceptUnix()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("namespace fd server: %w", err)
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server and removes its socket.
+func (s *NamespaceFdServer) Close() error {
+	return s.listener.Close()
+}
+
+func (s *NamespaceFdServer) serveConn(conn *net.UnixConn) {
+	defer conn.Close()
+
+	cred, err := peerCred(conn)
+	if err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		files, err := s.open(cred, scanner.Text())
+		if err != nil {
+			if sendFds(conn, []byte("error: "+err.Error()), nil) != nil {
+				return
+			}
+			continue
+		}
+		raw := make([]int, len(files))
+		for i, f := range files {
+			raw[i] = int(f.Fd())
+		}
+		err = sendFds(conn, []byte("ok"), raw)
+		for _, f := range files {
+			f.Close()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// open handles one request line for the client with cred.
+func (s *NamespaceFdServer) open(cred *unix.Ucred, line string) ([]*os.File, error) {
+	pidField, typeField, ok := strings.Cut(strings.TrimSpace(line), " ")
+	pid, err := strconv.Atoi(pidField)
+	if !ok || err != nil || pid <= 0 || typeField == "" {
+		return nil, fmt.Errorf("bad request %q: want PID TYPE[,TYPE...]", line)
+	}
+
+	authorize := s.Authorize
+	if authorize == nil {
+		authorize = authorizeOwner
+	}
+	var files []*os.File
+	for _, nsType := range strings.Split(typeField, ",") {
+		if _, ok := NamespaceTypes[nsType]; !ok {
+			closeFiles(files)
+			return nil, newNsError("lookup", pid, nsType, ErrUnsupportedNamespace)
+		}
+		if err := authorize(cred, pid, nsType); err != nil {
+			closeFiles(files)
+			return nil, err
+		}
+		f, err := os.Open(NsPath(pid, nsType))
+		if err != nil {
+			closeFiles(files)
+			return nil, newNsError("open", pid, nsType, err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// authorizeOwner lets root have any namespace and other users those of
+// their own processes.
+func authorizeOwner(cred *unix.Ucred, pid int, nsType string) error {
+	if cred.Uid == 0 {
+		return nil
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(fmt.Sprintf("/proc/%d", pid), &st); err != nil {
+		return newNsError("open", pid, nsType, err)
+	}
+	if st.Uid != cred.Uid {
+		return newNsError("open", pid, nsType, fmt.Errorf("%w: process belongs to uid %d", ErrPermission, st.Uid))
+	}
+	return nil
+}
+
+func peerCred(conn *net.UnixConn) (*unix.Ucred, error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *unix.Ucred
+	var credErr error
+	err = rc.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	return cred, err
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// RequestNamespaceFds asks the NamespaceFdServer on the other end of conn
+// for the given namespaces of pid and returns the files in the same order.
+func RequestNamespaceFds(conn *net.UnixConn, pid int, types []string) ([]*os.File, error) {
+	if _, err := fmt.Fprintf(conn, "%d %s\n", pid, strings.Join(types, ",")); err != nil {
+		return nil, fmt.Errorf("request namespace fds: %w", err)
+	}
+	data, files, err := receiveFds(conn, 4096, len(types))
+	if err != nil {
+		return nil, err
+	}
+	if msg, ok := strings.CutPrefix(string(data), "error: "); ok {
+		closeFiles(files)
+		return nil, fmt.Errorf("request namespace fds of pid %d: %s", pid, msg)
+	}
+	if len(files) != len(types) {
+		closeFiles(files)
+		return nil, fmt.Errorf("request namespace fds of pid %d: got %d files, want %d", pid, len(files), len(types))
+	}
+	return files, nil
+}
@@ -0,0 +1,196 @@
+package ns
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// IPCResources lists the System V IPC objects of an ipc namespace.
+type IPCResources struct {
+	ShmSegments []ShmInfo
+	Semaphores  []SemInfo
+	MsgQueues   []MsgQueueInfo
+}
+
+// ShmInfo is a shared memory segment from /proc/sysvipc/shm.
+type ShmInfo struct {
+	Key    int32
+	ID     int
+	Perms  os.FileMode
+	Size   uint64
+	Cpid   int
+	Lpid   int
+	Nattch int
+	Uid    int
+	Gid    int
+}
+
+// SemInfo is a semaphore set from /proc/sysvipc/sem.
+type SemInfo struct {
+	Key   int32
+	ID    int
+	Perms os.FileMode
+	Nsems int
+	Uid   int
+	Gid   int
+}
+
+// MsgQueueInfo is a message queue from /proc/sysvipc/msg.
+type MsgQueueInfo struct {
+	Key      int32
+	ID       int
+	Perms    os.FileMode
+	Bytes    uint64
+	Messages uint64
+	Uid      int
+	Gid      int
+}
+
+// ListIPCResources lists the shared memory segments, semaphore sets and
+// message queues in the ipc namespace of pid.
+//
+// The files under /proc/sysvipc show the ipc namespace of the thread that
+// opens them, not that of the process whose /proc is read, so reading them
+// through /proc/PID/root/proc/sysvipc would list the caller's own objects.
+// Instead they are opened by a thread that has entered the namespace; what
+// they list is fixed at open, so they are read afterwards from here. That
+// takes CAP_SYS_ADMIN over the namespace, which the /proc/PID/root path would
+// not have needed had it worked.
+func ListIPCResources(pid int) (*IPCResources, error) {
+	names := []string{"shm", "sem", "msg"}
+	type result struct {
+		files []*os.File
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// Never unlocked: the thread ends up in the target's namespace.
+		runtime.LockOSThread()
+		if err := EnterNamespace(pid, "ipc"); err != nil {
+			done <- result{err: err}
+			return
+		}
+		var files []*os.File
+		for _, name := range names {
+			f, err := os.Open("/proc/sysvipc/" + name)
+			if err != nil {
+				for _, f := range files {
+					f.Close()
+				}
+				done <- result{err: newNsError("list", pid, "ipc", err)}
+				return
+			}
+			files = append(files, f)
+		}
+		done <- result{files: files}
+	}()
+	r := <-done
+	if r.err != nil {
+		return nil, r.err
+	}
+	defer func() {
+		for _, f := range r.files {
+			f.Close()
+		}
+	}()
+
+	res := &IPCResources{}
+	parsers := []func(map[string]string) error{
+		func(row map[string]string) error {
+			var s ShmInfo
+			err := parseIPCRow(row, map[string]any{
+				"key": &s.Key, "shmid": &s.ID, "perms": &s.Perms, "size": &s.Size,
+				"cpid": &s.Cpid, "lpid": &s.Lpid, "nattch": &s.Nattch,
+				"uid": &s.Uid, "gid": &s.Gid,
+			})
+			res.ShmSegments = append(res.ShmSegments, s)
+			return err
+		},
+		func(row map[string]string) error {
+			var s SemInfo
+			err := parseIPCRow(row, map[string]any{
+				"key": &s.Key, "semid": &s.ID, "perms": &s.Perms, "nsems": &s.Nsems,
+				"uid": &s.Uid, "gid": &s.Gid,
+			})
+			res.Semaphores = append(res.Semaphores, s)
+			return err
+		},
+		func(row map[string]string) error {
+			var q MsgQueueInfo
+			err := parseIPCRow(row, map[string]any{
+				"key": &q.Key, "msqid": &q.ID, "perms": &q.Perms, "cbytes": &q.Bytes,
+				"qnum": &q.Messages, "uid": &q.Uid, "gid": &q.Gid,
+			})
+			res.MsgQueues = append(res.MsgQueues, q)
+			return err
+		},
+	}
+	for i, f := range r.files {
+		if err := readIPCTable(f, parsers[i]); err != nil {
+			return nil, newNsError("list", pid, "ipc", fmt.Errorf("/proc/sysvipc/%s: %w", names[i], err))
+		}
+	}
+	return res, nil
+}
+
+// readIPCTable calls fn with each row of a /proc/sysvipc table, keyed by
+// the column names of its header.
+func readIPCTable(r io.Reader, fn func(map[string]string) error) error {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		return scanner.Err()
+	}
+	header := strings.Fields(scanner.Text())
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != len(header) {
+			return fmt.Errorf("malformed line %q", scanner.Text())
+		}
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			row[name] = fields[i]
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// parseIPCRow parses the columns of row named in dst into the pointers
+// there. perms is octal, as the kernel prints it; the rest is decimal.
+func parseIPCRow(row map[string]string, dst map[string]any) error {
+	for name, p := range dst {
+		value, ok := row[name]
+		if !ok {
+			return fmt.Errorf("no %s column", name)
+		}
+		var err error
+		switch p := p.(type) {
+		case *int32:
+			var v int64
+			v, err = strconv.ParseInt(value, 10, 32)
+			*p = int32(v)
+		case *int:
+			*p, err = strconv.Atoi(value)
+		case *uint64:
+			*p, err = strconv.ParseUint(value, 10, 64)
+		case *os.FileMode:
+			var v uint64
+			v, err = strconv.ParseUint(value, 8, 32)
+			*p = os.FileMode(v)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
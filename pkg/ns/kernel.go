@@ -0,0 +1,83 @@
+package ns
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// minKernel is the first kernel release that can setns into each
+// namespace type.
+var minKernel = map[string][2]int{
+	"net":    {3, 0},
+	"ipc":    {3, 0},
+	"uts":    {3, 0},
+	"mnt":    {3, 8},
+	"pid":    {3, 8},
+	"user":   {3, 8},
+	"cgroup": {4, 6},
+	"time":   {5, 6},
+}
+
+// KernelVersion returns the version of the running kernel, taken from the
+// release uname reports. Parts missing from the release are 0.
+func KernelVersion() (major, minor, patch int, err error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return 0, 0, 0, fmt.Errorf("uname: %w", err)
+	}
+	release := unix.ByteSliceToString(uts.Release[:])
+
+	// Releases look like 6.1.0-18-amd64 or 5.15.0+.
+	numbers, _, _ := strings.Cut(release, "-")
+	var version [3]int
+	for i, part := range strings.SplitN(numbers, ".", 3) {
+		digits := strings.TrimRightFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			if i == 0 {
+				return 0, 0, 0, fmt.Errorf("parse kernel release %q", release)
+			}
+			break
+		}
+		version[i] = n
+	}
+	return version[0], version[1], version[2], nil
+}
+
+// NamespaceSupported reports whether the running kernel is new enough to
+// enter namespaces of type nsType.
+func NamespaceSupported(nsType string) (bool, error) {
+	min, ok := minKernel[nsType]
+	if !ok {
+		return false, ErrUnsupportedNamespace
+	}
+	return kernelAtLeast(min[0], min[1])
+}
+
+// checkSupported fails with a clear error if the kernel is too old for
+// nsType. pid is only used for errors.
+func checkSupported(pid int, nsType string) error {
+	min := minKernel[nsType]
+	ok, err := kernelAtLeast(min[0], min[1])
+	if err != nil {
+		return newNsError("check", pid, nsType, err)
+	}
+	if ok {
+		return nil
+	}
+	// Only for the message; kernelAtLeast just read it.
+	major, minor, _, _ := KernelVersion()
+	return newNsError("check", pid, nsType, fmt.Errorf("%w: %s namespace requires kernel >= %d.%d; current kernel is %d.%d", ErrUnsupportedNamespace, nsType, min[0], min[1], major, minor))
+}
+
+// kernelAtLeast reports whether the running kernel is at least major.minor.
+func kernelAtLeast(major, minor int) (bool, error) {
+	kMajor, kMinor, _, err := KernelVersion()
+	if err != nil {
+		return false, err
+	}
+	return kMajor > major || (kMajor == major && kMinor >= minor), nil
+}
@@ -0,0 +1,141 @@
+package ns
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// NsInfo identifies one namespace of a process.
+type NsInfo struct {
+	Type   string `json:"type"`
+	Inode  uint64 `json:"inode"`
+	Device uint64 `json:"device"`
+	Path   string `json:"path"`
+}
+
+// ListNamespaces returns the namespaces pid belongs to, one per entry under
+// /proc/PID/ns.
+func ListNamespaces(pid int) ([]NsInfo, error) {
+	return listNamespaces(fmt.Sprintf("/proc/%d/ns", pid))
+}
+
+// BatchError is returned by ListNamespacesBatch alongside the results it
+// did get when some PIDs could not be listed, typically because they exited.
+type BatchError struct {
+	Errors map[int]error
+}
+
+func (e *BatchError) Error() string {
+	pids := make([]int, 0, len(e.Errors))
+	for pid := range e.Errors {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return fmt.Sprintf("could not list namespaces of %d processes (first: pid %d: %v)", len(pids), pids[0], e.Errors[pids[0]])
+}
+
+// ListNamespacesBatch runs ListNamespaces for each of pids, at most
+// concurrency at a time, or one per CPU if concurrency is 0 or less. The
+// namespaces of every PID that could be listed are returned, keyed by PID;
+// if any could not, their errors come with them as a *BatchError.
+func ListNamespacesBatch(pids []int, concurrency int) (map[int][]NsInfo, error) {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, concurrency)
+		result = make(map[int][]NsInfo, len(pids))
+		batch  = &BatchError{Errors: map[int]error{}}
+	)
+	for _, pid := range pids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			infos, err := ListNamespaces(pid)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				batch.Errors[pid] = err
+				return
+			}
+			result[pid] = infos
+		}()
+	}
+	wg.Wait()
+	if len(batch.Errors) > 0 {
+		return result, batch
+	}
+	return result, nil
+}
+
+// GetCurrentNamespaces returns the namespaces of the calling OS thread,
+// keyed by the entry names under /proc/thread-self/ns, so pid and
+// pid_for_children are separate keys.
+//
+// Namespaces are per thread, and a Go program moves goroutines between
+// threads, so the answer is only meaningful for the goroutine that asks if
+// it has called runtime.LockOSThread, or if no thread of the program has
+// entered other namespaces. For the namespaces the process as a whole is
+// known by, those of its main thread that other processes see, use
+// ListNamespaces(os.Getpid()), which reads /proc/self/ns.
+func GetCurrentNamespaces() (map[string]NsInfo, error) {
+	dir := "/proc/thread-self/ns"
+	if _, err := os.Stat(dir); err != nil {
+		// thread-self only exists since Linux 3.17.
+		dir = fmt.Sprintf("/proc/self/task/%d/ns", unix.Gettid())
+	}
+	infos, err := listNamespaces(dir)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]NsInfo, len(infos))
+	for _, info := range infos {
+		current[info.Type] = info
+	}
+	return current, nil
+}
+
+func listNamespaces(dir string) ([]NsInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("list namespaces: %w", err)
+	}
+
+	infos := make([]NsInfo, 0, len(entries))
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, fmt.Errorf("list namespaces: %w", err)
+		}
+		_, inode, err := ParseNsSymlink(target)
+		if err != nil {
+			return nil, fmt.Errorf("list namespaces: %s: %w", path, err)
+		}
+		var st unix.Stat_t
+		if err := unix.Stat(path, &st); err != nil {
+			return nil, fmt.Errorf("list namespaces: stat %s: %w", path, err)
+		}
+		infos = append(infos, NsInfo{
+			// Use the entry name so pid_for_children and friends stay
+			// distinguishable from pid.
+			Type:   entry.Name(),
+			Inode:  inode,
+			Device: uint64(st.Dev),
+			Path:   path,
+		})
+	}
+	return infos, nil
+}
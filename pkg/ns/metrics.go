@@ -0,0 +1,86 @@
+package ns
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+// nsMetrics are the collectors RegisterMetrics installs.
+type nsMetrics struct {
+	enters  *prometheus.CounterVec
+	latency *prometheus.HistogramVec
+	errors  *prometheus.CounterVec
+}
+
+// metrics is nil until RegisterMetrics is called, so unregistered programs
+// pay nothing beyond a nil check.
+var metrics *nsMetrics
+
+// RegisterMetrics registers Prometheus metrics for namespace entry with reg
+// and starts recording them:
+//
+//   - nsenter_enter_total{type,result}: namespace enter attempts, with
+//     result success or failure
+//   - nsenter_setns_duration_seconds{type}: latency of each setns call
+//   - nsenter_setns_errors_total{type,errno}: failed setns calls, with
+//     errno EPERM, EAGAIN or other
+//
+// It should be called once, before namespaces are entered.
+func RegisterMetrics(reg prometheus.Registerer) error {
+	m := &nsMetrics{
+		enters: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nsenter_enter_total",
+			Help: "Namespace enter attempts by namespace type and result.",
+		}, []string{"type", "result"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nsenter_setns_duration_seconds",
+			Help:    "Latency of setns calls by namespace type.",
+			Buckets: prometheus.ExponentialBuckets(1e-6, 4, 10),
+		}, []string{"type"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nsenter_setns_errors_total",
+			Help: "Failed setns calls by namespace type and errno.",
+		}, []string{"type", "errno"}),
+	}
+	for _, c := range []prometheus.Collector{m.enters, m.latency, m.errors} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	metrics = m
+	return nil
+}
+
+// observeSetns records one setns call.
+func observeSetns(nsType string, elapsed time.Duration, err error) {
+	if metrics == nil {
+		return
+	}
+	metrics.latency.WithLabelValues(nsType).Observe(elapsed.Seconds())
+	if err == nil {
+		return
+	}
+	errno := "other"
+	switch {
+	case errors.Is(err, unix.EPERM):
+		errno = "EPERM"
+	case errors.Is(err, unix.EAGAIN):
+		errno = "EAGAIN"
+	}
+	metrics.errors.WithLabelValues(nsType, errno).Inc()
+}
+
+// observeEnter records the outcome of entering an nsType namespace.
+func observeEnter(nsType string, err error) {
+	if metrics == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.enters.WithLabelValues(nsType, result).Inc()
+}
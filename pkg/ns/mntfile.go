@@ -0,0 +1,70 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// ReadFileInMountNs reads the file at path in the mount namespace of pid,
+// through /proc/PID/root, without entering the namespace. path is taken
+// relative to the target's root whether or not it starts with a slash.
+//
+// Symlinks are resolved inside the target's root with openat2's
+// RESOLVE_IN_ROOT. Kernels before 5.6 lack it; there the open falls back to
+// a plain one under /proc/PID/root, where an absolute symlink, such as
+// /etc/resolv.conf -> /run/..., resolves in the caller's namespace instead.
+func ReadFileInMountNs(pid int, path string) ([]byte, error) {
+	f, err := openInRoot(pid, path, unix.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("read %s in mount namespace of pid %d: %w", path, pid, err)
+	}
+	return data, nil
+}
+
+// StatFileInMountNs is like os.Stat for path in the mount namespace of
+// pid, with the symlink handling described at ReadFileInMountNs.
+func StatFileInMountNs(pid int, path string) (os.FileInfo, error) {
+	f, err := openInRoot(pid, path, unix.O_PATH)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat %s in mount namespace of pid %d: %w", path, pid, err)
+	}
+	return info, nil
+}
+
+// openInRoot opens path relative to the root directory of pid.
+func openInRoot(pid int, path string, flags int) (*os.File, error) {
+	rootPath := fmt.Sprintf("/proc/%d/root", pid)
+	root, err := os.Open(rootPath)
+	if err != nil {
+		return nil, newNsError("open root of", pid, "mnt", err)
+	}
+	defer root.Close()
+
+	rel := filepath.Join(".", filepath.Clean("/"+path))
+	fd, err := unix.Openat2(int(root.Fd()), rel, &unix.OpenHow{
+		Flags:   uint64(flags | unix.O_CLOEXEC),
+		Resolve: unix.RESOLVE_IN_ROOT,
+	})
+	if errors.Is(err, unix.ENOSYS) {
+		fd, err = unix.Openat(int(root.Fd()), rel, flags|unix.O_CLOEXEC, 0)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %s in mount namespace of pid %d: %w", path, pid, &os.PathError{Op: "open", Path: filepath.Join(rootPath, rel), Err: err})
+	}
+	return os.NewFile(uintptr(fd), filepath.Join(rootPath, rel)), nil
+}
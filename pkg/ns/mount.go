@@ -0,0 +1,81 @@
+package ns
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// RemountProc mounts a fresh procfs on /proc, so /proc reflects the calling
+// process's pid namespace. The mount is made in the caller's current mount
+// namespace and must come from a process inside the pid namespace: setns
+// alone only moves future children, and procfs reflects the mounter's own
+// pid namespace.
+func RemountProc() error {
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount proc on /proc: %w", err)
+	}
+	return nil
+}
+
+// RemountSys replaces the sysfs on /sys with a fresh one, and the cgroup2
+// hierarchy on /sys/fs/cgroup if there was one, so they reflect the calling
+// thread's network and cgroup namespaces: sysfs shows the interfaces of the
+// network namespace it was mounted from, and cgroupfs roots its view at
+// the mounter's cgroup namespace. Unlike procfs, both go by the thread's
+// namespaces, so no fork is needed after setns. Mount namespaces are not,
+// so make the change in a private copy of the target's.
+func RemountSys() error {
+	var st unix.Statfs_t
+	cgroup2 := unix.Statfs("/sys/fs/cgroup", &st) == nil && st.Type == unix.CGROUP2_SUPER_MAGIC
+	if err := unix.Unmount("/sys", unix.MNT_DETACH); err != nil && err != unix.EINVAL {
+		// EINVAL: /sys was not a mount point to begin with.
+		return fmt.Errorf("unmount /sys: %w", err)
+	}
+	if err := unix.Mount("sysfs", "/sys", "sysfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount sysfs on /sys: %w", err)
+	}
+	if cgroup2 {
+		if err := unix.Mount("cgroup2", "/sys/fs/cgroup", "cgroup2", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+			return fmt.Errorf("mount cgroup2 on /sys/fs/cgroup: %w", err)
+		}
+	}
+	return nil
+}
+
+// PivotRoot makes newRoot the root of the calling thread's mount namespace,
+// the way OCI runtimes switch to a container's rootfs: newRoot is bind
+// mounted onto itself so it is a mount point, the old root is moved to
+// putOld, a directory inside newRoot created for it, and then unmounted and
+// removed. The working directory ends up at the new /.
+//
+// Every process in the mount namespace whose root was the old one moves
+// along, so call it in a private mount namespace, such as one just
+// unshared; see NsenterConfig.PivotRoot. pivot_root fails with EINVAL if a
+// mount involved has shared propagation.
+func PivotRoot(newRoot, putOld string) error {
+	if err := unix.Mount(newRoot, newRoot, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind mount %s onto itself: %w", newRoot, err)
+	}
+	oldPath := filepath.Join(newRoot, putOld)
+	if err := os.MkdirAll(oldPath, 0o700); err != nil {
+		return fmt.Errorf("pivot root: %w", err)
+	}
+	if err := unix.PivotRoot(newRoot, oldPath); err != nil {
+		return fmt.Errorf("pivot_root %s %s: %w", newRoot, oldPath, err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return fmt.Errorf("pivot root: change directory to /: %w", err)
+	}
+	// putOld as seen from the new root.
+	inside := filepath.Join("/", putOld)
+	if err := unix.Unmount(inside, unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmount old root %s: %w", inside, err)
+	}
+	if err := os.Remove(inside); err != nil {
+		return fmt.Errorf("pivot root: %w", err)
+	}
+	return nil
+}
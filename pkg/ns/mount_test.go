@@ -0,0 +1,120 @@
+package ns_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"bustakube.com/nsenter/pkg/ns"
+	"bustakube.com/nsenter/pkg/ns/nstest"
+)
+
+// newRootfs returns a directory to use as a root in the mount namespace n:
+// it holds a marker file and the host's /usr, bind mounted in n only, with
+// the symlinks of a merged /usr next to it. The thread that mounts is never
+// returned to the test, so only n sees the mount.
+func newRootfs(t *testing.T, n ns.Namespace) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "rootfs-marker"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "usr"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bin", "sbin", "lib", "lib64", "libx32"} {
+		target, err := os.Readlink("/" + name)
+		if err != nil {
+			if name == "bin" {
+				t.Skip("needs a merged /usr, with /bin a symlink into it")
+			}
+			continue
+		}
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Mount from a thread of its own rather than with n.Do: if leaving n
+	// failed, the test's goroutine would be left in it, and the TempDir
+	// cleanup would recurse into the bind mount of the host's /usr.
+	err := onLockedThread(func() error {
+		if err := ns.EnterNamespaceByPath(n.Path(), "mnt"); err != nil {
+			return err
+		}
+		// Keep the bind mount from propagating out of n.
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+			return err
+		}
+		return unix.Mount("/usr", filepath.Join(root, "usr"), "", unix.MS_BIND|unix.MS_REC, "")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// rootEntries returns the names in root, sorted as ls(1) prints them.
+func rootEntries(t *testing.T, root string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// TestPivotRoot switches the command's root in a mount namespace, owned by
+// a user namespace when not run as root, and lists it.
+func TestPivotRoot(t *testing.T) {
+	if asRoot(t) {
+		return
+	}
+	n := nstest.NewTestNamespace(t, "mnt")
+	root := newRootfs(t, n)
+
+	c := ns.NewNsenterConfig(n.(*ns.ProcNamespace).Pid, ns.WithMountNs(), ns.WithCommand(lookPath(t, "ls"), "/"))
+	c.PivotRoot = root
+	out, err := runConfig(t, c)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	want := rootEntries(t, root)
+	if got := strings.Fields(out); !slices.Equal(got, want) {
+		t.Errorf("ls / after pivot_root printed %q, want %q", got, want)
+	}
+	if _, err := os.Stat("/rootfs-marker"); err == nil {
+		t.Error("the test's own root changed")
+	}
+}
+
+// TestChroot changes the command's root to a directory of the entered mount
+// namespace, so that ls / lists it and not the host's root.
+func TestChroot(t *testing.T) {
+	if asRoot(t) {
+		return
+	}
+	n := nstest.NewTestNamespace(t, "mnt")
+	root := newRootfs(t, n)
+
+	c := ns.NewNsenterConfig(n.(*ns.ProcNamespace).Pid, ns.WithMountNs(), ns.WithCommand(lookPath(t, "ls"), "/"))
+	c.Chroot = root
+	out, err := runConfig(t, c)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	got := strings.Fields(out)
+	if want := rootEntries(t, root); !slices.Equal(got, want) {
+		t.Errorf("ls / after chroot printed %q, want %q", got, want)
+	}
+	if host := rootEntries(t, "/"); slices.Equal(got, host) {
+		t.Errorf("ls / after chroot printed the host's root %q", host)
+	}
+}
@@ -0,0 +1,108 @@
+package ns
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MountEntry is one line of /proc/PID/mountinfo; see proc(5).
+type MountEntry struct {
+	MountID    int    `json:"mount_id"`
+	ParentID   int    `json:"parent_id"`
+	Dev        string `json:"dev"`
+	Root       string `json:"root"`
+	MountPoint string `json:"mount_point"`
+	Options    string `json:"options"`
+	// Tags are the optional fields, such as shared:1 or master:2, that
+	// give the mount's propagation.
+	Tags         []string `json:"tags"`
+	FSType       string   `json:"fs_type"`
+	Source       string   `json:"source"`
+	SuperOptions string   `json:"super_options"`
+}
+
+// ParseMountInfo returns the mount table of the mount namespace of pid, as
+// seen from its root.
+func ParseMountInfo(pid int) ([]MountEntry, error) {
+	path := fmt.Sprintf("/proc/%d/mountinfo", pid)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, newNsError("read mounts of", pid, "mnt", err)
+	}
+	defer f.Close()
+
+	var entries []MountEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		entry, err := parseMountInfoLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// parseMountInfoLine parses a line like
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfoLine(line string) (MountEntry, error) {
+	fields := strings.Fields(line)
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+	if len(fields) < 6 || sep < 0 || len(fields) < sep+3 {
+		return MountEntry{}, fmt.Errorf("malformed mountinfo line %q", line)
+	}
+
+	var entry MountEntry
+	var err error
+	if entry.MountID, err = strconv.Atoi(fields[0]); err != nil {
+		return MountEntry{}, fmt.Errorf("malformed mountinfo line %q", line)
+	}
+	if entry.ParentID, err = strconv.Atoi(fields[1]); err != nil {
+		return MountEntry{}, fmt.Errorf("malformed mountinfo line %q", line)
+	}
+	entry.Dev = fields[2]
+	entry.Root = unescapeMountField(fields[3])
+	entry.MountPoint = unescapeMountField(fields[4])
+	entry.Options = fields[5]
+	entry.Tags = append([]string{}, fields[6:sep]...)
+	entry.FSType = fields[sep+1]
+	entry.Source = unescapeMountField(fields[sep+2])
+	if len(fields) > sep+3 {
+		entry.SuperOptions = fields[sep+3]
+	}
+	return entry, nil
+}
+
+// unescapeMountField undoes the octal escapes, such as \040 for a space,
+// the kernel uses for whitespace and backslashes in mountinfo paths.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,166 @@
+package ns
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// Namespace is a namespace that the calling thread can enter and later
+// leave again. Enter and Exit act on the calling OS thread, so callers must
+// hold runtime.LockOSThread across them.
+type Namespace interface {
+	// Enter moves the thread into the namespace, remembering the one it
+	// was in before.
+	Enter() error
+	// Exit moves the thread back to the namespace it was in before Enter.
+	Exit() error
+	// Path is the file the namespace is opened from.
+	Path() string
+	// Inode is the namespace's inode number, which identifies it.
+	Inode() (uint64, error)
+	// Do runs fn on the calling goroutine's thread while it is in the
+	// namespace, handling the thread locking itself.
+	Do(fn func() error) error
+	// Clone creates a new namespace of the same type from inside this one
+	// and returns it pinned to a temporary file. See nsHandle.Clone.
+	Clone() (Namespace, error)
+}
+
+// nsHandle implements Namespace for any namespace file.
+type nsHandle struct {
+	path   string
+	nsType string
+	saved  *os.File
+}
+
+func (h *nsHandle) Path() string { return h.path }
+
+func (h *nsHandle) Inode() (uint64, error) {
+	id, err := statNs(h.path)
+	if err != nil {
+		return 0, err
+	}
+	return id.ino, nil
+}
+
+func (h *nsHandle) Enter() error {
+	if h.saved != nil {
+		return fmt.Errorf("%s namespace %s already entered", h.nsType, h.path)
+	}
+	saved, err := os.Open("/proc/thread-self/ns/" + h.nsType)
+	if err != nil {
+		return newNsError("save", 0, h.nsType, err)
+	}
+	if err := EnterNamespaceByPath(h.path, h.nsType); err != nil {
+		saved.Close()
+		return err
+	}
+	h.saved = saved
+	return nil
+}
+
+func (h *nsHandle) Exit() error {
+	if h.saved == nil {
+		return fmt.Errorf("%s namespace %s not entered", h.nsType, h.path)
+	}
+	defer func() {
+		h.saved.Close()
+		h.saved = nil
+	}()
+	if err := unix.Setns(int(h.saved.Fd()), NamespaceTypes[h.nsType]); err != nil {
+		return newNsError("restore", 0, h.nsType, err)
+	}
+	return nil
+}
+
+// Do locks the calling goroutine to its thread, enters the namespace, runs
+// fn and exits the namespace again, returning the first error. A panic in fn
+// is recovered long enough to exit the namespace and then re-raised.
+//
+// The thread is only unlocked once it is back in its original namespace; if
+// Exit fails, or the namespace is a mount namespace, it stays locked so it
+// is discarded when the goroutine exits.
+func (h *nsHandle) Do(fn func() error) (err error) {
+	runtime.LockOSThread()
+	if err := h.Enter(); err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer func() {
+		r := recover()
+		if exitErr := h.Exit(); exitErr != nil {
+			if err == nil {
+				err = exitErr
+			}
+		} else if reusable([]string{h.nsType}) {
+			runtime.UnlockOSThread()
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+	return fn()
+}
+
+// ProcNamespace is the namespace of a process, reached through
+// /proc/PID/ns/TYPE. It stops being reachable once the process exits.
+type ProcNamespace struct {
+	nsHandle
+	Pid  int
+	Type string
+}
+
+// NewProcNamespace returns the nsType namespace of pid.
+func NewProcNamespace(pid int, nsType string) (*ProcNamespace, error) {
+	if _, ok := NamespaceTypes[nsType]; !ok {
+		return nil, newNsError("lookup", pid, nsType, ErrUnsupportedNamespace)
+	}
+	return &ProcNamespace{
+		nsHandle: nsHandle{path: NsPath(pid, nsType), nsType: nsType},
+		Pid:      pid,
+		Type:     nsType,
+	}, nil
+}
+
+// PinnedNamespace is a namespace kept alive by a bind mount of its nsfs
+// file, as ip netns does under /var/run/netns.
+type PinnedNamespace struct {
+	nsHandle
+	Type string
+}
+
+// NewPinnedNamespace returns the nsType namespace pinned at path.
+func NewPinnedNamespace(path, nsType string) (*PinnedNamespace, error) {
+	if _, ok := NamespaceTypes[nsType]; !ok {
+		return nil, newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+	}
+	return &PinnedNamespace{
+		nsHandle: nsHandle{path: path, nsType: nsType},
+		Type:     nsType,
+	}, nil
+}
+
+var procNsPath = regexp.MustCompile(`^/proc/(\d+)/ns/([a-z_]+)$`)
+
+// OpenNamespace returns the namespace at path: a ProcNamespace for
+// /proc/PID/ns/TYPE and a PinnedNamespace for anything else. The type of a
+// pinned namespace is asked from the kernel.
+func OpenNamespace(path string) (Namespace, error) {
+	if m := procNsPath.FindStringSubmatch(path); m != nil {
+		pid, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("open namespace %s: %w", path, err)
+		}
+		return NewProcNamespace(pid, m[2])
+	}
+	nsType, err := nsTypeOf(path)
+	if err != nil {
+		return nil, fmt.Errorf("open namespace %s: %w", path, err)
+	}
+	return NewPinnedNamespace(path, nsType)
+}
@@ -0,0 +1,211 @@
+package ns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// IfaceStats holds the traffic counters of a network interface, from
+// struct rtnl_link_stats64.
+type IfaceStats struct {
+	RxPackets uint64
+	TxPackets uint64
+	RxBytes   uint64
+	TxBytes   uint64
+	RxErrors  uint64
+	TxErrors  uint64
+	RxDropped uint64
+	TxDropped uint64
+}
+
+// ListNetInterfaces lists the interfaces of the network namespace n, the
+// way net.Interfaces does for the caller's own. The netlink socket is
+// opened inside n, and the request is answered from there.
+func ListNetInterfaces(n Namespace) ([]net.Interface, error) {
+	var ifaces []net.Interface
+	err := withNetlink(n, func(c *nlConn) error {
+		replies, err := c.request(unix.RTM_GETLINK, unix.NLM_F_DUMP, ifInfomsg(0, 0, 0))
+		if err != nil {
+			return fmt.Errorf("list links: %w", err)
+		}
+		for _, m := range replies {
+			if m.Header.Type != unix.RTM_NEWLINK {
+				continue
+			}
+			iface, _, err := parseLink(&m)
+			if err != nil {
+				return err
+			}
+			ifaces = append(ifaces, iface)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list interfaces in %s: %w", n.Path(), err)
+	}
+	return ifaces, nil
+}
+
+// GetIfaceStats returns the traffic counters of the interface called name
+// in the network namespace n.
+func GetIfaceStats(n Namespace, name string) (*IfaceStats, error) {
+	var stats *IfaceStats
+	err := withNetlink(n, func(c *nlConn) error {
+		replies, err := c.request(unix.RTM_GETLINK, 0, concat(ifInfomsg(0, 0, 0), nlAttr(unix.IFLA_IFNAME, nlString(name))))
+		if err != nil {
+			return fmt.Errorf("look up link %s: %w", name, err)
+		}
+		for _, m := range replies {
+			if m.Header.Type != unix.RTM_NEWLINK {
+				continue
+			}
+			_, s, err := parseLink(&m)
+			if err != nil {
+				return err
+			}
+			if s == nil {
+				return fmt.Errorf("link %s: no statistics", name)
+			}
+			stats = s
+			return nil
+		}
+		return fmt.Errorf("look up link %s: not found", name)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("interface stats in %s: %w", n.Path(), err)
+	}
+	return stats, nil
+}
+
+// ListInterfacesInNamespace returns the names of the interfaces in the
+// network namespace n.
+func ListInterfacesInNamespace(n Namespace) ([]string, error) {
+	ifaces, err := ListNetInterfaces(n)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(ifaces))
+	for i, iface := range ifaces {
+		names[i] = iface.Name
+	}
+	return names, nil
+}
+
+// MoveInterfaceToNamespace moves the interface ifaceName from the calling
+// thread's network namespace into targetNs, like ip link set NAME netns.
+// It keeps its name, which must be free there, and arrives down and
+// without the addresses it had. A caller that has entered some other
+// network namespace must have locked its OS thread.
+func MoveInterfaceToNamespace(ifaceName string, targetNs Namespace) error {
+	target, err := os.Open(targetNs.Path())
+	if err != nil {
+		return fmt.Errorf("move %s: %w", ifaceName, err)
+	}
+	defer target.Close()
+
+	c, err := openNetlink()
+	if err != nil {
+		return fmt.Errorf("move %s: %w", ifaceName, err)
+	}
+	defer c.Close()
+	index, err := c.linkIndex(ifaceName)
+	if err != nil {
+		return fmt.Errorf("move %s: %w", ifaceName, err)
+	}
+	if err := c.setLinkNs(index, int(target.Fd())); err != nil {
+		return fmt.Errorf("move %s to %s: %w", ifaceName, targetNs.Path(), err)
+	}
+	return nil
+}
+
+// withNetlink calls fn with a netlink socket opened in n. The socket keeps
+// talking to n, so only opening it needs the thread to be in n.
+func withNetlink(n Namespace, fn func(*nlConn) error) error {
+	var c *nlConn
+	if err := n.Do(func() (err error) {
+		c, err = openNetlink()
+		return err
+	}); err != nil {
+		return err
+	}
+	defer c.Close()
+	return fn(c)
+}
+
+// parseLink decodes an RTM_NEWLINK message. The stats are nil if the
+// kernel sent none.
+func parseLink(m *syscall.NetlinkMessage) (net.Interface, *IfaceStats, error) {
+	var iface net.Interface
+	if len(m.Data) < unix.SizeofIfInfomsg {
+		return iface, nil, fmt.Errorf("netlink: short link message")
+	}
+	iface.Index = int(int32(binary.NativeEndian.Uint32(m.Data[4:8])))
+	iface.Flags = linkFlags(binary.NativeEndian.Uint32(m.Data[8:12]))
+
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return iface, nil, fmt.Errorf("netlink parse: %w", err)
+	}
+	var stats *IfaceStats
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case unix.IFLA_IFNAME:
+			iface.Name = string(trimNul(a.Value))
+		case unix.IFLA_MTU:
+			if len(a.Value) >= 4 {
+				iface.MTU = int(binary.NativeEndian.Uint32(a.Value))
+			}
+		case unix.IFLA_ADDRESS:
+			// All zeroes for interfaces without one, such as lo.
+			for _, b := range a.Value {
+				if b != 0 {
+					iface.HardwareAddr = net.HardwareAddr(append([]byte(nil), a.Value...))
+					break
+				}
+			}
+		case unix.IFLA_STATS64:
+			if len(a.Value) >= 8*8 {
+				stats = &IfaceStats{}
+				for i, p := range []*uint64{
+					&stats.RxPackets, &stats.TxPackets, &stats.RxBytes, &stats.TxBytes,
+					&stats.RxErrors, &stats.TxErrors, &stats.RxDropped, &stats.TxDropped,
+				} {
+					*p = binary.NativeEndian.Uint64(a.Value[8*i:])
+				}
+			}
+		}
+	}
+	return iface, stats, nil
+}
+
+// linkFlags converts IFF_* link flags to net.Flags.
+func linkFlags(raw uint32) net.Flags {
+	var flags net.Flags
+	for iff, f := range map[uint32]net.Flags{
+		unix.IFF_UP:          net.FlagUp,
+		unix.IFF_BROADCAST:   net.FlagBroadcast,
+		unix.IFF_LOOPBACK:    net.FlagLoopback,
+		unix.IFF_POINTOPOINT: net.FlagPointToPoint,
+		unix.IFF_MULTICAST:   net.FlagMulticast,
+		unix.IFF_RUNNING:     net.FlagRunning,
+	} {
+		if raw&iff != 0 {
+			flags |= f
+		}
+	}
+	return flags
+}
+
+func trimNul(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
@@ -0,0 +1,167 @@
+package ns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// vethInfoPeer is VETH_INFO_PEER from linux/veth.h.
+const vethInfoPeer = 1
+
+// nlConn is a NETLINK_ROUTE socket. It talks to the network namespace of
+// the thread that opened it, whatever thread later uses it.
+type nlConn struct {
+	fd  int
+	seq uint32
+}
+
+func openNetlink() (*nlConn, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("netlink socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("netlink bind: %w", err)
+	}
+	return &nlConn{fd: fd}, nil
+}
+
+func (c *nlConn) Close() error {
+	return unix.Close(c.fd)
+}
+
+// request sends a message and collects the replies until the kernel
+// acknowledges it or, for dumps, signals the end. It returns the replies
+// other than the acknowledgement.
+func (c *nlConn) request(msgType uint16, flags uint16, body []byte) ([]syscall.NetlinkMessage, error) {
+	c.seq++
+	msg := make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(body))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(unix.SizeofNlMsghdr+len(body)))
+	binary.NativeEndian.PutUint16(msg[4:6], msgType)
+	binary.NativeEndian.PutUint16(msg[6:8], flags|unix.NLM_F_REQUEST|unix.NLM_F_ACK)
+	binary.NativeEndian.PutUint32(msg[8:12], c.seq)
+	msg = append(msg, body...)
+	if err := unix.Sendto(c.fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("netlink send: %w", err)
+	}
+
+	var replies []syscall.NetlinkMessage
+	for {
+		// The replies point into buf, so each read needs a fresh one.
+		buf := make([]byte, 1<<16)
+		n, _, err := unix.Recvfrom(c.fd, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("netlink receive: %w", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("netlink parse: %w", err)
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != c.seq {
+				continue
+			}
+			switch m.Header.Type {
+			case unix.NLMSG_DONE:
+				return replies, nil
+			case unix.NLMSG_ERROR:
+				if len(m.Data) < 4 {
+					return nil, fmt.Errorf("netlink: short error message")
+				}
+				if errno := int32(binary.NativeEndian.Uint32(m.Data[:4])); errno != 0 {
+					return nil, syscall.Errno(-errno)
+				}
+				return replies, nil
+			default:
+				replies = append(replies, m)
+			}
+		}
+	}
+}
+
+// nlAttr encodes a route attribute, padded to four bytes.
+func nlAttr(attrType uint16, payload []byte) []byte {
+	b := make([]byte, 4, nlAlign(4+len(payload)))
+	binary.NativeEndian.PutUint16(b[0:2], uint16(4+len(payload)))
+	binary.NativeEndian.PutUint16(b[2:4], attrType)
+	b = append(b, payload...)
+	return b[:cap(b)]
+}
+
+func nlAlign(n int) int {
+	return (n + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+}
+
+func nlString(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func nlUint32(v uint32) []byte {
+	return binary.NativeEndian.AppendUint32(nil, v)
+}
+
+// ifInfomsg encodes struct ifinfomsg.
+func ifInfomsg(index int32, flags, change uint32) []byte {
+	b := make([]byte, unix.SizeofIfInfomsg)
+	b[0] = unix.AF_UNSPEC
+	binary.NativeEndian.PutUint32(b[4:8], uint32(index))
+	binary.NativeEndian.PutUint32(b[8:12], flags)
+	binary.NativeEndian.PutUint32(b[12:16], change)
+	return b
+}
+
+// concat joins message parts.
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// linkIndex returns the index of the interface called name.
+func (c *nlConn) linkIndex(name string) (int32, error) {
+	replies, err := c.request(unix.RTM_GETLINK, 0, concat(ifInfomsg(0, 0, 0), nlAttr(unix.IFLA_IFNAME, nlString(name))))
+	if err != nil {
+		return 0, fmt.Errorf("look up link %s: %w", name, err)
+	}
+	for _, m := range replies {
+		if m.Header.Type == unix.RTM_NEWLINK && len(m.Data) >= unix.SizeofIfInfomsg {
+			return int32(binary.NativeEndian.Uint32(m.Data[4:8])), nil
+		}
+	}
+	return 0, fmt.Errorf("look up link %s: not found", name)
+}
+
+// setLinkUp brings the link up.
+func (c *nlConn) setLinkUp(index int32) error {
+	_, err := c.request(unix.RTM_NEWLINK, 0, ifInfomsg(index, unix.IFF_UP, unix.IFF_UP))
+	return err
+}
+
+// setLinkNs moves the link into the network namespace open as nsFd.
+func (c *nlConn) setLinkNs(index int32, nsFd int) error {
+	_, err := c.request(unix.RTM_SETLINK, 0, concat(ifInfomsg(index, 0, 0), nlAttr(unix.IFLA_NET_NS_FD, nlUint32(uint32(nsFd)))))
+	return err
+}
+
+// addAddr assigns an IPv4 address to the link.
+func (c *nlConn) addAddr(index int32, addr net.IPNet) error {
+	ip := addr.IP.To4()
+	if ip == nil {
+		return fmt.Errorf("add address %s: only IPv4 is supported", addr.String())
+	}
+	ones, _ := addr.Mask.Size()
+	msg := make([]byte, unix.SizeofIfAddrmsg)
+	msg[0] = unix.AF_INET
+	msg[1] = byte(ones)
+	binary.NativeEndian.PutUint32(msg[4:8], uint32(index))
+	msg = concat(msg, nlAttr(unix.IFA_LOCAL, ip), nlAttr(unix.IFA_ADDRESS, ip))
+	_, err := c.request(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, msg)
+	return err
+}
@@ -0,0 +1,93 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// NetnsDir is where ip netns pins named network namespaces.
+const NetnsDir = "/var/run/netns"
+
+// NamedNetNsPath returns the pin path of the ip netns namespace name.
+func NamedNetNsPath(name string) string {
+	return filepath.Join(NetnsDir, name)
+}
+
+// EnterNamedNetNs moves the calling thread into the network namespace that
+// ip netns knows as name.
+func EnterNamedNetNs(name string) error {
+	return EnterNamespaceByPath(NamedNetNsPath(name), "net")
+}
+
+// CreateNamedNetNs creates a network namespace, pins it as name the way
+// ip netns add does, and brings up its loopback interface. The calling
+// thread stays in its own network namespace.
+func CreateNamedNetNs(name string) error {
+	if name == "" || name != filepath.Base(name) {
+		return fmt.Errorf("create netns %q: invalid name", name)
+	}
+	if err := os.MkdirAll(NetnsDir, 0o755); err != nil {
+		return fmt.Errorf("create netns %s: %w", name, err)
+	}
+	path := NamedNetNsPath(name)
+	// The bind mount needs an existing file to cover.
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE|os.O_EXCL, 0)
+	if err != nil {
+		return fmt.Errorf("create netns %s: %w", name, err)
+	}
+	f.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		// Never unlocked: the thread ends up in the new namespace.
+		runtime.LockOSThread()
+		errc <- createNetNsOnThread(path)
+	}()
+	if err := <-errc; err != nil {
+		os.Remove(path)
+		return fmt.Errorf("create netns %s: %w", name, err)
+	}
+	return nil
+}
+
+func createNetNsOnThread(path string) error {
+	if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("unshare: %w", err)
+	}
+	if err := unix.Mount("/proc/thread-self/ns/net", path, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("pin: %w", err)
+	}
+	if err := linkUp("lo"); err != nil {
+		// Leave no half-made namespace behind.
+		return errors.Join(err, unix.Unmount(path, unix.MNT_DETACH))
+	}
+	return nil
+}
+
+// linkUp sets IFF_UP on the interface name in the thread's network
+// namespace.
+func linkUp(name string) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("bring up %s: %w", name, err)
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		return fmt.Errorf("bring up %s: %w", name, err)
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("bring up %s: %w", name, err)
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("bring up %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package ns enters the Linux namespaces of a running process.
+//
+// Namespaces are per-thread, so callers must hold runtime.LockOSThread for
+// as long as they expect the calling goroutine to stay in the namespaces it
+// entered.
+package ns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// NamespaceTypes maps the namespace names used under /proc/PID/ns to their
+// CLONE_NEW* constants. Add to it with RegisterNamespaceType.
+var NamespaceTypes = map[string]int{
+	"mnt":    unix.CLONE_NEWNS,
+	"net":    unix.CLONE_NEWNET,
+	"ipc":    unix.CLONE_NEWIPC,
+	"uts":    unix.CLONE_NEWUTS,
+	"user":   unix.CLONE_NEWUSER,
+	"pid":    unix.CLONE_NEWPID,
+	"cgroup": unix.CLONE_NEWCGROUP,
+	"time":   cloneNewTime,
+}
+
+// NSMap is the old name of NamespaceTypes, and the same map.
+//
+// Deprecated: use NamespaceTypes.
+var NSMap = NamespaceTypes
+
+// RegisterNamespaceType adds a namespace type that this package does not
+// know yet, such as one from a newer kernel, by its name under
+// /proc/PID/ns and its CLONE_NEW* flag. It is then accepted everywhere the
+// built-in types are, and NsenterConfig.Run enters it after the other
+// types but before mnt and pid, with nothing special done around setns.
+// It is an error to register an existing name or flag.
+//
+// NamespaceTypes is not guarded against concurrent use, so register
+// types from an init function, before any namespace is entered.
+func RegisterNamespaceType(name string, cloneFlag int) error {
+	if name == "" || strings.ContainsAny(name, "/,=:") {
+		return fmt.Errorf("register namespace type %q: invalid name", name)
+	}
+	if _, ok := NamespaceTypes[name]; ok {
+		return fmt.Errorf("register namespace type %s: already registered", name)
+	}
+	for other, flag := range NamespaceTypes {
+		if flag == cloneFlag {
+			return fmt.Errorf("register namespace type %s: flag %#x is already used by %s", name, cloneFlag, other)
+		}
+	}
+	NamespaceTypes[name] = cloneFlag
+	cloneNames[name] = fmt.Sprintf("%#x", cloneFlag)
+	i := slices.Index(enterOrder, "mnt")
+	enterOrder = slices.Insert(enterOrder, i, name)
+	return nil
+}
+
+// NsPath returns the /proc path of the nsType namespace of pid.
+func NsPath(pid int, nsType string) string {
+	return fmt.Sprintf("/proc/%d/ns/%s", pid, nsType)
+}
+
+// EnterNamespace moves the calling thread into the nsType namespace of pid.
+//
+// Entering a mount namespace first unshares the current one so the setns
+// does not affect other threads sharing it.
+func EnterNamespace(pid int, nsType string) error {
+	return EnterNamespaceCtx(context.Background(), pid, nsType)
+}
+
+// EnterNamespaceCtx is like EnterNamespace but gives up with ctx's error if
+// ctx is done before the namespace file is opened or before setns is called.
+func EnterNamespaceCtx(ctx context.Context, pid int, nsType string) error {
+	return enterPath(ctx, nil, NsPath(pid, nsType), pid, nsType)
+}
+
+// EnterNamespaceTimeout is like EnterNamespaceCtx but also gives up once
+// timeout has passed, even while the namespace file is being opened, which
+// can block on a target stuck in D state. The open then carries on in the
+// background and the file is closed as soon as it returns. setns itself
+// does not block, so checking the deadline just before it is enough.
+func EnterNamespaceTimeout(ctx context.Context, pid int, nsType string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	nsConst, ok := NamespaceTypes[nsType]
+	if !ok {
+		return newNsError("lookup", pid, nsType, ErrUnsupportedNamespace)
+	}
+	if err := checkSupported(pid, nsType); err != nil {
+		return err
+	}
+
+	type opened struct {
+		f   *os.File
+		err error
+	}
+	// Buffered, so the open never blocks on sending once nobody listens.
+	result := make(chan opened, 1)
+	go func() {
+		f, err := os.Open(NsPath(pid, nsType))
+		result <- opened{f, err}
+	}()
+
+	select {
+	case r := <-result:
+		if r.err != nil {
+			return newNsError("open", pid, nsType, r.err)
+		}
+		defer r.f.Close()
+		return setnsFd(ctx, nil, int(r.f.Fd()), pid, nsType, nsConst)
+	case <-ctx.Done():
+		go func() {
+			if r := <-result; r.f != nil {
+				r.f.Close()
+			}
+		}()
+		return ctx.Err()
+	}
+}
+
+// EnterNamespaceByPath moves the calling thread into the namespace pinned at
+// path, such as /var/run/netns/NAME. If nsType is empty it is taken from the
+// base name of path.
+func EnterNamespaceByPath(path string, nsType string) error {
+	if nsType == "" {
+		nsType = filepath.Base(path)
+	}
+	return enterPath(context.Background(), nil, path, 0, nsType)
+}
+
+// enterPath opens path and joins the nsType namespace behind it. pid is
+// only used for errors.
+func enterPath(ctx context.Context, opts *setnsOptions, path string, pid int, nsType string) error {
+	nsConst, ok := NamespaceTypes[nsType]
+	if !ok {
+		return newNsError("lookup", pid, nsType, ErrUnsupportedNamespace)
+	}
+	if err := checkSupported(pid, nsType); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	fd, err := os.Open(path)
+	opts.debug("open", "path", path, "fd", fdOf(fd), "err", err, "elapsed", time.Since(start))
+	if err != nil {
+		return newNsError("open", pid, nsType, err)
+	}
+	defer fd.Close()
+
+	return setnsFd(ctx, opts, int(fd.Fd()), pid, nsType, nsConst)
+}
+
+// EnterNamespaceByFd moves the calling thread into the nsType namespace
+// referred to by fd, for example one received from a privileged helper over
+// a Unix socket. The caller keeps ownership of fd; it is not closed.
+func EnterNamespaceByFd(fd int, nsType string) error {
+	nsConst, ok := NamespaceTypes[nsType]
+	if !ok {
+		return newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+	}
+	if err := checkSupported(0, nsType); err != nil {
+		return err
+	}
+	return setnsFd(context.Background(), nil, fd, 0, nsType, nsConst)
+}
+
+// OpenNamespaceFds opens the given namespaces of pid without entering any
+// of them. Opening everything first means a target that exits midway fails
+// the whole operation up front instead of leaving the caller half-entered.
+// If any cannot be opened the others are closed again. The caller closes
+// the returned files.
+func OpenNamespaceFds(pid int, types []string) (map[string]*os.File, error) {
+	fds := make(map[string]*os.File, len(types))
+	for _, nsType := range types {
+		if _, ok := NamespaceTypes[nsType]; !ok {
+			closeAll(fds)
+			return nil, newNsError("lookup", pid, nsType, ErrUnsupportedNamespace)
+		}
+		if err := checkSupported(pid, nsType); err != nil {
+			closeAll(fds)
+			return nil, err
+		}
+		f, err := os.Open(NsPath(pid, nsType))
+		if err != nil {
+			closeAll(fds)
+			return nil, newNsError("open", pid, nsType, err)
+		}
+		fds[nsType] = f
+	}
+	return fds, nil
+}
+
+// setnsFd joins the namespace behind fd, retrying on EAGAIN. pid is only
+// used for errors.
+func setnsFd(ctx context.Context, opts *setnsOptions, fd int, pid int, nsType string, nsConst int) error {
+	var id nsID
+	if opts != nil && opts.cache {
+		var hit bool
+		if hit, id = cachedIn(fd, nsType); hit {
+			opts.debug("skip", "nstype", cloneNames[nsType], "reason", "cached")
+			return nil
+		}
+	}
+
+	if nsType == "mnt" {
+		start := time.Now()
+		err := unix.Unshare(unix.CLONE_NEWNS)
+		opts.debug("unshare", "flags", "CLONE_NEWNS", "err", err, "elapsed", time.Since(start))
+		if err != nil {
+			return newNsError("unshare", pid, nsType, err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var before uint64
+	if opts != nil && opts.audit != nil {
+		before = threadNsInode(nsType)
+	}
+	err := setnsRetry(ctx, opts, fd, nsType, nsConst)
+	observeEnter(nsType, err)
+	if opts != nil && opts.audit != nil {
+		entry := AuditEntry{
+			Time:        time.Now().UTC(),
+			CallerPid:   os.Getpid(),
+			TargetPid:   pid,
+			NsType:      nsType,
+			InodeBefore: before,
+			InodeAfter:  threadNsInode(nsType),
+			Success:     err == nil,
+			Command:     opts.command,
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if auditErr := opts.audit.Log(entry); auditErr != nil && err == nil {
+			// An unrecorded transition must not go ahead silently.
+			return auditErr
+		}
+	}
+	if err != nil {
+		if err == ctx.Err() {
+			return err
+		}
+		if errors.Is(err, unix.EINVAL) {
+			err = explainEinval(fd, nsType, err)
+		}
+		return newNsError("setns", pid, nsType, err)
+	}
+	if opts != nil && opts.cache {
+		remember(nsType, id)
+	}
+	return nil
+}
+
+// cloneNames holds the names of the CLONE_NEW* constants in
+// NamespaceTypes, for logging.
+var cloneNames = map[string]string{
+	"mnt":    "CLONE_NEWNS",
+	"net":    "CLONE_NEWNET",
+	"ipc":    "CLONE_NEWIPC",
+	"uts":    "CLONE_NEWUTS",
+	"user":   "CLONE_NEWUSER",
+	"pid":    "CLONE_NEWPID",
+	"cgroup": "CLONE_NEWCGROUP",
+	"time":   "CLONE_NEWTIME",
+}
+
+// logDebug logs at debug level to logger, which may be nil.
+func logDebug(logger *slog.Logger, msg string, args ...any) {
+	if logger != nil {
+		logger.Debug(msg, args...)
+	}
+}
+
+// fdOf returns the descriptor of f, or -1 if f is nil.
+func fdOf(f *os.File) int {
+	if f == nil {
+		return -1
+	}
+	return int(f.Fd())
+}
@@ -0,0 +1,109 @@
+package ns_test
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// onLockedThread runs fn on a goroutine locked to a thread that is never
+// unlocked, so whatever fn does to the thread's namespaces ends with it.
+func onLockedThread(fn func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		errc <- fn()
+	}()
+	return <-errc
+}
+
+// threadInode returns the inode of the calling thread's nsType namespace.
+// For pid and time that is the one its children get, which is what setns
+// changes.
+func threadInode(nsType string) (uint64, error) {
+	if nsType == "pid" || nsType == "time" {
+		nsType += "_for_children"
+	}
+	var st unix.Stat_t
+	if err := unix.Stat("/proc/thread-self/ns/"+nsType, &st); err != nil {
+		return 0, err
+	}
+	return st.Ino, nil
+}
+
+// asRoot makes sure the rest of the test runs with root privileges over
+// the namespaces it creates. Without root it runs the test again in a new
+// user namespace that maps the caller to root, and returns true once that
+// run is over; the caller should then return. The test is skipped if the
+// kernel or sandbox does not allow unprivileged user namespaces.
+func asRoot(t *testing.T) bool {
+	t.Helper()
+	if os.Geteuid() == 0 {
+		return false
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$", "-test.v")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	out, err := cmd.CombinedOutput()
+	if len(out) == 0 && err != nil {
+		t.Skipf("cannot run in a user namespace: %v", err)
+	}
+	t.Logf("in a user namespace:\n%s", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return true
+}
+
+// enterableTypes are the types a multithreaded test binary can join.
+var enterableTypes = []string{"uts", "ipc", "net", "mnt", "cgroup", "pid"}
+
+// TestEnterNamespace runs unprivileged through asRoot: the namespaces it
+// enters are owned by a user namespace it created.
+func TestEnterNamespace(t *testing.T) {
+	if asRoot(t) {
+		return
+	}
+	for _, nsType := range enterableTypes {
+		t.Run(nsType, func(t *testing.T) {
+			cmd := exec.Command("sleep", "infinity")
+			cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: uintptr(ns.NSMap[nsType])}
+			if err := cmd.Start(); err != nil {
+				t.Skipf("cannot create %s namespace: %v", nsType, err)
+			}
+			defer func() {
+				cmd.Process.Kill()
+				cmd.Wait()
+			}()
+
+			var st unix.Stat_t
+			if err := unix.Stat(ns.NsPath(cmd.Process.Pid, nsType), &st); err != nil {
+				t.Fatal(err)
+			}
+			var got uint64
+			err := onLockedThread(func() error {
+				if err := ns.EnterNamespace(cmd.Process.Pid, nsType); err != nil {
+					return err
+				}
+				var err error
+				got, err = threadInode(nsType)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != st.Ino {
+				t.Errorf("thread is in %s namespace %d, want %d", nsType, got, st.Ino)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package ns
+
+import "runtime"
+
+// NSContext describes a set of namespaces of a process that a goroutine can
+// temporarily move into.
+//
+// Namespaces belong to OS threads, not goroutines, so Attach and the
+// restore function it returns must be called from the goroutine that makes
+// the namespace-sensitive syscalls, and that goroutine must not hand the
+// work to others in between.
+type NSContext struct {
+	pid   int
+	types []string
+}
+
+// NewNSContext returns a context for the given namespaces of pid.
+func NewNSContext(pid int, types []string) *NSContext {
+	return &NSContext{pid: pid, types: types}
+}
+
+// Attach locks the calling goroutine to its OS thread, saves the thread's
+// namespaces and enters the configured ones. The returned restore function
+// moves the thread back and unlocks it:
+//
+//	restore, err := nsCtx.Attach()
+//	if err != nil {
+//		return err
+//	}
+//	defer restore()
+//
+// If the thread cannot be fully restored, or the mount namespace was
+// entered, it stays locked, so it is thrown away when the goroutine exits
+// instead of being reused in the wrong namespaces or working directory.
+// On error the thread has already been restored and restore is nil.
+func (c *NSContext) Attach() (restore func(), err error) {
+	runtime.LockOSThread()
+
+	snap, err := SaveNamespaces(c.types)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, err
+	}
+
+	restore = func() {
+		defer snap.Close()
+		if snap.Restore() == nil && reusable(c.types) {
+			runtime.UnlockOSThread()
+		}
+	}
+	if err := EnterSubset(c.pid, c.types); err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
@@ -0,0 +1,56 @@
+package ns_test
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// threadInodes returns the inode of each namespace of the calling thread
+// that can be read.
+func threadInodes() map[string]uint64 {
+	inodes := map[string]uint64{}
+	for nsType := range ns.NamespaceTypes {
+		if inode, err := threadInode(nsType); err == nil {
+			inodes[nsType] = inode
+		}
+	}
+	return inodes
+}
+
+// FuzzEnterNamespace makes a thread enter its own namespace of a fuzzed
+// type. It must either succeed or fail with an *ns.NsError, and either way
+// leave the thread in the namespaces it started in. The thread's TID is
+// used rather than the PID: /proc/PID/ns shows the main thread's, which an
+// earlier test may have left elsewhere.
+func FuzzEnterNamespace(f *testing.F) {
+	for _, seed := range []string{"net", "mnt", "uts", "user", "pid", "", "bogus", "net/../mnt", "pid_for_children", "NET"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, nsType string) {
+		var before, after map[string]uint64
+		err := onLockedThread(func() error {
+			before = threadInodes()
+			err := ns.EnterNamespace(unix.Gettid(), nsType)
+			after = threadInodes()
+			return err
+		})
+		if err != nil {
+			var nsErr *ns.NsError
+			if !errors.As(err, &nsErr) {
+				t.Fatalf("EnterNamespace(%q): got %T %v, want *ns.NsError", nsType, err, err)
+			}
+			if _, known := ns.NamespaceTypes[nsType]; !known && !errors.Is(err, ns.ErrUnsupportedNamespace) {
+				t.Errorf("EnterNamespace(%q): got %v, want ErrUnsupportedNamespace", nsType, err)
+			}
+		}
+		for typ, inode := range before {
+			if after[typ] != inode {
+				t.Errorf("EnterNamespace(%q) moved the thread from %s namespace %d to %d", nsType, typ, inode, after[typ])
+			}
+		}
+	})
+}
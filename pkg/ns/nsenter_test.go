@@ -0,0 +1,120 @@
+package ns_test
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"bustakube.com/nsenter/pkg/ns"
+	"bustakube.com/nsenter/pkg/ns/nstest"
+)
+
+func requireRoot(t testing.TB) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to join namespaces it did not create")
+	}
+}
+
+func TestEnterNamespaceByPath(t *testing.T) {
+	requireRoot(t)
+	n := nstest.NewTestNamespace(t, "net")
+	want, err := n.Inode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got uint64
+	err = onLockedThread(func() error {
+		// The type comes from the base name of the path.
+		if err := ns.EnterNamespaceByPath(n.Path(), ""); err != nil {
+			return err
+		}
+		got, err = threadInode("net")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("thread is in net namespace %d, want %d", got, want)
+	}
+}
+
+func TestNamespaceDo(t *testing.T) {
+	before, err := threadInode("uts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nstest.WithTestNamespace(t, "uts", func(n ns.Namespace) {
+		want, err := n.Inode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := threadInode("uts"); err != nil || got != want {
+			t.Errorf("inside Do: uts namespace %d, %v; want %d", got, err, want)
+		}
+		if want == before {
+			t.Errorf("test namespace %d is the test's own", want)
+		}
+	})
+}
+
+func TestEnterNamespaceErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		enter func() error
+		want  error
+	}{
+		{"unknown type", func() error { return ns.EnterNamespace(os.Getpid(), "bogus") }, ns.ErrUnsupportedNamespace},
+		// Above the kernel's highest pid_max, so never a live process.
+		{"no process", func() error { return ns.EnterNamespace(1<<30, "net") }, ns.ErrNoProcess},
+		{"no file", func() error { return ns.EnterNamespaceByPath("testdata/missing", "net") }, ns.ErrNamespaceGone},
+		{"type mismatch", func() error { return ns.EnterNamespaceByPath("/proc/self/ns/net", "uts") }, ns.ErrTypeMismatch},
+		{"not a namespace", func() error { return ns.EnterNamespaceByPath("testdata/not-a-namespace", "net") }, unix.EINVAL},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := onLockedThread(tt.enter)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			var nsErr *ns.NsError
+			if !errors.As(err, &nsErr) {
+				t.Errorf("got %T, want *ns.NsError", err)
+			}
+		})
+	}
+}
+
+// TestUserNamespace runs unprivileged: NewTestNamespace creates user
+// namespaces without root.
+func TestUserNamespace(t *testing.T) {
+	n := nstest.NewTestNamespace(t, "user")
+	pid := n.(*ns.ProcNamespace).Pid
+
+	uidMap, err := ns.ReadUidMap(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid := uint32(os.Getuid())
+	if !slices.ContainsFunc(uidMap, func(m ns.IdMapping) bool { return m.HostID == uid && m.Size == 1 }) {
+		t.Errorf("uid_map %v does not map %d", uidMap, uid)
+	}
+	owner, err := ns.ReadUserNsOwner(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != os.Getuid() {
+		t.Errorf("owner %d, want %d", owner, os.Getuid())
+	}
+
+	// The test binary is multithreaded, which the kernel does not allow
+	// into a user namespace; the error should say so rather than claim a
+	// type mismatch.
+	err = onLockedThread(func() error { return ns.EnterNamespace(pid, "user") })
+	if !errors.Is(err, unix.EINVAL) || errors.Is(err, ns.ErrTypeMismatch) {
+		t.Errorf("entering user namespace: got %v, want EINVAL that is no type mismatch", err)
+	}
+}
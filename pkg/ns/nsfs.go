@@ -0,0 +1,89 @@
+package ns
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioctls on nsfs files, from linux/nsfs.h.
+const (
+	nsGetParent = 0xb702
+	nsGetNstype = 0xb703
+	// nsGetOwnerUid fills in a uid_t.
+	nsGetOwnerUid = 0xb704
+)
+
+// nsTypeOf returns the type of the namespace at path, which may be a
+// /proc/PID/ns entry or a bind mount of one.
+func nsTypeOf(path string) (string, error) {
+	if target, err := os.Readlink(path); err == nil {
+		if nsType, _, err := ParseNsSymlink(target); err == nil {
+			return nsType, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	nsType, err := nsTypeOfFd(int(f.Fd()))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return nsType, nil
+}
+
+// nsTypeOfFd returns the type of the namespace open as fd.
+func nsTypeOfFd(fd int) (string, error) {
+	flag, err := unix.IoctlRetInt(fd, nsGetNstype)
+	if err != nil {
+		return "", fmt.Errorf("not a namespace: %w", err)
+	}
+	for nsType, c := range NamespaceTypes {
+		if c == flag {
+			return nsType, nil
+		}
+	}
+	return "", fmt.Errorf("unknown namespace type %#x", flag)
+}
+
+// einvalReasons says why setns refuses a namespace of the right type.
+var einvalReasons = map[string]string{
+	"user": "the thread is already in it or in a descendant of it, or the process is multithreaded",
+	"pid":  "it is not the current pid namespace or a descendant of it",
+	"mnt":  "the thread shares its filesystem attributes with others",
+	"time": "the thread has already forked children into the current one",
+}
+
+// explainEinval turns the EINVAL setns gave for fd, which was to join an
+// nsType namespace, into a message that says what is wrong: fd is no
+// namespace, is one of another type (ErrTypeMismatch), or is one that the
+// kernel will not let the thread join. The fdinfo of nsfs files names no
+// type, so the kernel is asked through NS_GET_NSTYPE.
+func explainEinval(fd int, nsType string, err error) error {
+	actual, typeErr := nsTypeOfFd(fd)
+	if typeErr != nil {
+		target, _ := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+		return fmt.Errorf("fd %d (%s) is %v: %w", fd, target, typeErr, err)
+	}
+	if actual != nsType {
+		return fmt.Errorf("%w: fd %d is a %s namespace, not %s: %w", ErrTypeMismatch, fd, actual, nsType, err)
+	}
+	if reason, ok := einvalReasons[nsType]; ok {
+		return fmt.Errorf("%w (%s)", err, reason)
+	}
+	return err
+}
+
+// nsParent returns the parent of the pid or user namespace open as f. The
+// caller closes the result.
+func nsParent(f *os.File) (*os.File, error) {
+	fd, err := unix.IoctlRetInt(int(f.Fd()), nsGetParent)
+	if err != nil {
+		return nil, fmt.Errorf("parent of %s: %w", f.Name(), err)
+	}
+	return os.NewFile(uintptr(fd), "parent of "+f.Name()), nil
+}
@@ -0,0 +1,81 @@
+// Package nstest provides throwaway namespaces for tests of code built on
+// package ns.
+package nstest
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// NewTestNamespace returns a fresh namespace of type nsType that lives until
+// the test ends.
+//
+// The namespace is held by a sleeping child process cloned into it, which
+// works for pid namespaces too. When the test does not run as root the child
+// also gets a new user namespace mapping the caller's IDs, so creating the
+// namespace needs no privileges. Entering it from the test still requires
+// whatever the kernel demands of setns; WithTestNamespace skips the test if
+// that is refused. The test is skipped if the kernel or sandbox does not
+// allow creating the namespace at all.
+func NewTestNamespace(t testing.TB, nsType string) ns.Namespace {
+	t.Helper()
+
+	flag, ok := ns.NamespaceTypes[nsType]
+	if !ok {
+		t.Fatalf("nstest: unknown namespace type %q", nsType)
+	}
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skipf("nstest: need sleep to hold the namespace: %v", err)
+	}
+
+	cmd := exec.Command(sleep, "infinity")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: uintptr(flag)}
+	if os.Geteuid() != 0 && nsType != "user" {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+	}
+	if cmd.SysProcAttr.Cloneflags&syscall.CLONE_NEWUSER != 0 {
+		uid, gid := os.Getuid(), os.Getgid()
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("nstest: cannot create %s namespace: %v", nsType, err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	n, err := ns.NewProcNamespace(cmd.Process.Pid, nsType)
+	if err != nil {
+		t.Fatalf("nstest: %v", err)
+	}
+	return n
+}
+
+// WithTestNamespace creates a namespace with NewTestNamespace and runs fn
+// with the calling goroutine's thread inside it, moving the thread back
+// afterwards. fn must do its namespace-sensitive work on the calling
+// goroutine. The test is skipped if the namespace cannot be entered for
+// lack of privileges.
+func WithTestNamespace(t testing.TB, nsType string, fn func(n ns.Namespace)) {
+	t.Helper()
+
+	n := NewTestNamespace(t, nsType)
+	err := n.Do(func() error {
+		fn(n)
+		return nil
+	})
+	if errors.Is(err, ns.ErrPermission) {
+		t.Skipf("nstest: cannot enter %s namespace: %v", nsType, err)
+	}
+	if err != nil {
+		t.Fatalf("nstest: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package ns
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// OciNamespace is an entry of the linux.namespaces array of an OCI runtime
+// spec. Type uses the spec's names, such as "network" and "mount".
+type OciNamespace struct {
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+}
+
+// ociTypes maps OCI namespace types to the names used under /proc/PID/ns.
+var ociTypes = map[string]string{
+	"pid":     "pid",
+	"network": "net",
+	"mount":   "mnt",
+	"ipc":     "ipc",
+	"uts":     "uts",
+	"user":    "user",
+	"cgroup":  "cgroup",
+	"time":    "time",
+}
+
+// ParseOCINamespaces reads the linux.namespaces array of the OCI runtime
+// spec at specPath, typically a bundle's config.json.
+func ParseOCINamespaces(specPath string) ([]OciNamespace, error) {
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		return nil, fmt.Errorf("read OCI spec: %w", err)
+	}
+	var spec struct {
+		Linux struct {
+			Namespaces []OciNamespace `json:"namespaces"`
+		} `json:"linux"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("parse OCI spec %s: %w", specPath, err)
+	}
+	for _, n := range spec.Linux.Namespaces {
+		if _, ok := ociTypes[n.Type]; !ok {
+			return nil, fmt.Errorf("parse OCI spec %s: unknown namespace type %q", specPath, n.Type)
+		}
+	}
+	return spec.Linux.Namespaces, nil
+}
+
+// EnterFromOCISpec moves the calling thread into the namespaces listed in
+// the OCI runtime spec at specPath: entries with a path are joined, the
+// others are created with unshare. Namespaces are handled in the same order
+// as NsenterConfig.Run. As with Unshare, a new user namespace cannot be
+// created from a Go process.
+func EnterFromOCISpec(specPath string) error {
+	namespaces, err := ParseOCINamespaces(specPath)
+	if err != nil {
+		return err
+	}
+
+	byType := map[string]OciNamespace{}
+	for _, n := range namespaces {
+		byType[ociTypes[n.Type]] = n
+	}
+	var unshare []string
+	for _, nsType := range enterOrder {
+		n, ok := byType[nsType]
+		if !ok {
+			continue
+		}
+		if n.Path == "" {
+			unshare = append(unshare, nsType)
+			continue
+		}
+		if err := EnterNamespaceByPath(n.Path, nsType); err != nil {
+			return err
+		}
+	}
+	if len(unshare) == 0 {
+		return nil
+	}
+	// Unshare after joining, so new namespaces are owned by the user
+	// namespace the spec asked for.
+	return Unshare(unshare)
+}
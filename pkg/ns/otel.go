@@ -0,0 +1,57 @@
+package ns
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans this package makes.
+const tracerName = "bustakube.com/nsenter/pkg/ns"
+
+// EnterNamespaceWithTracing is like EnterNamespaceCtx but records the entry
+// as an nsenter.EnterNamespace span from the global tracer provider, with
+// the pid, namespace type and inode as attributes. The returned context
+// carries the span.
+func EnterNamespaceWithTracing(ctx context.Context, pid int, nsType string) (context.Context, error) {
+	ctx, span := startEnterSpan(ctx, otel.Tracer(tracerName), pid, nsType, NsPath(pid, nsType))
+	err := EnterNamespaceCtx(ctx, pid, nsType)
+	endSpan(span, err)
+	return ctx, err
+}
+
+// startEnterSpan starts the span for entering the namespace at path.
+func startEnterSpan(ctx context.Context, tracer trace.Tracer, pid int, nsType, path string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.Int("pid", pid),
+		attribute.String("nsType", nsType),
+	}
+	if id, err := statNs(path); err == nil {
+		attrs = append(attrs, attribute.Int64("inode", int64(id.ino)))
+	}
+	return tracer.Start(ctx, "nsenter.EnterNamespace", trace.WithAttributes(attrs...))
+}
+
+// endSpan marks span as failed if err is not nil, then ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traced runs enter inside an nsenter.EnterNamespace span if c.Tracer is
+// set.
+func (c *NsenterConfig) traced(ctx context.Context, nsType string, enter func(context.Context) error) error {
+	if c.Tracer == nil {
+		return enter(ctx)
+	}
+	ctx, span := startEnterSpan(ctx, c.Tracer, c.nsPid(nsType), nsType, c.nsPath(nsType))
+	err := enter(ctx)
+	endSpan(span, err)
+	return err
+}
@@ -0,0 +1,117 @@
+package ns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// User is an entry of a passwd file.
+type User struct {
+	Name  string
+	Uid   uint32
+	Gid   uint32
+	Home  string
+	Shell string
+}
+
+// LookupUserInMountNs looks username up in /etc/passwd as seen inside the
+// mount namespace open as mntNsFd, such as /proc/PID/ns/mnt of a container
+// whose users differ from the host's. A numeric username is taken as a UID.
+func LookupUserInMountNs(mntNsFd *os.File, username string) (*User, error) {
+	type result struct {
+		user *User
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		// Never unlocked: the thread ends up in the other mount namespace.
+		runtime.LockOSThread()
+		if err := setnsFd(context.Background(), nil, int(mntNsFd.Fd()), 0, "mnt", NamespaceTypes["mnt"]); err != nil {
+			resc <- result{err: err}
+			return
+		}
+		u, err := LookupUser("/etc/passwd", username)
+		resc <- result{u, err}
+	}()
+	res := <-resc
+	return res.user, res.err
+}
+
+// LookupUser looks username, or a numeric UID, up in the passwd file at
+// path.
+func LookupUser(path, username string) (*User, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("look up user %s: %w", username, err)
+	}
+	defer f.Close()
+	return parsePasswd(f, username)
+}
+
+func parsePasswd(r io.Reader, username string) (*User, error) {
+	uid, err := strconv.ParseUint(username, 10, 32)
+	byUid := err == nil
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// name:password:UID:GID:GECOS:directory:shell
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) != 7 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		entryUid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		if fields[0] != username && !(byUid && entryUid == uid) {
+			continue
+		}
+		gid, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("look up user %s: bad GID %q", username, fields[3])
+		}
+		return &User{Name: fields[0], Uid: uint32(entryUid), Gid: uint32(gid), Home: fields[5], Shell: fields[6]}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("look up user %s: %w", username, err)
+	}
+	if byUid {
+		return &User{Uid: uint32(uid), Gid: uint32(uid)}, nil
+	}
+	return nil, fmt.Errorf("look up user %s: no such user", username)
+}
+
+// setCredential switches the process to c.Credential before it execs the
+// command, dropping supplementary groups unless it lists some. Go applies
+// setuid and setgid to every thread, so there is no undoing it if exec then
+// fails.
+func (c *NsenterConfig) setCredential() error {
+	cred := c.Credential
+	if cred == nil {
+		return nil
+	}
+	if !cred.NoSetGroups {
+		groups := make([]int, len(cred.Groups))
+		for i, g := range cred.Groups {
+			groups[i] = int(g)
+		}
+		if err := unix.Setgroups(groups); err != nil {
+			return fmt.Errorf("setgroups: %w", err)
+		}
+	}
+	if err := unix.Setresgid(int(cred.Gid), int(cred.Gid), int(cred.Gid)); err != nil {
+		return fmt.Errorf("setgid %d: %w", cred.Gid, err)
+	}
+	if err := unix.Setresuid(int(cred.Uid), int(cred.Uid), int(cred.Uid)); err != nil {
+		return fmt.Errorf("setuid %d: %w", cred.Uid, err)
+	}
+	return nil
+}
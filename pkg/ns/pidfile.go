@@ -0,0 +1,65 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReadPidFile returns the PID written in the file at path, such as
+// /var/run/myapp.pid, after checking that the process still exists.
+func ReadPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read pid file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("pid file %s: want a positive integer, got %q", path, strings.TrimSpace(string(data)))
+	}
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("pid file %s: process %d is not running; the file may be stale: %w", path, pid, ErrNoProcess)
+		}
+		return 0, fmt.Errorf("pid file %s: %w", path, err)
+	}
+	return pid, nil
+}
+
+var procPidPrefix = regexp.MustCompile(`^/proc/(\d+|self)(/|$)`)
+
+// ParseTarget parses a target given as a PID, or as a path under /proc/PID
+// such as /proc/1234/ns/net, copied from the output of another tool.
+// /proc/self is the calling process. Only the PID is taken from a path;
+// pinned namespace files elsewhere are not PIDs, see NewPinnedNamespace.
+func ParseTarget(target string) (int, error) {
+	if m := procPidPrefix.FindStringSubmatch(target); m != nil {
+		if m[1] == "self" {
+			return os.Getpid(), nil
+		}
+		target = m[1]
+	}
+	pid, err := strconv.Atoi(target)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("target %q: want a PID or a /proc/PID path", target)
+	}
+	return pid, nil
+}
+
+// TargetPidEnv names the environment variable ResolvePidFromEnv reads.
+const TargetPidEnv = "NSENTER_TARGET_PID"
+
+// ResolvePidFromEnv returns the PID in $NSENTER_TARGET_PID, for scripts that
+// set it once instead of passing --target to every call. ok is false if it
+// is unset or not a PID as ParseTarget takes it. The nsenter command only
+// falls back to it after --target and --pid-file.
+func ResolvePidFromEnv() (pid int, ok bool) {
+	pid, err := ParseTarget(strings.TrimSpace(os.Getenv(TargetPidEnv)))
+	if err != nil {
+		return 0, false
+	}
+	return pid, true
+}
@@ -0,0 +1,26 @@
+package ns_test
+
+import (
+	"strconv"
+	"testing"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+func FuzzParseTarget(f *testing.F) {
+	for _, seed := range []string{"1", "1234", "/proc/1234/ns/net", "/proc/self", "/proc/self/ns", "/proc/12x", "0", "-1", "+5", "/proc//ns", " 1"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, target string) {
+		pid, err := ns.ParseTarget(target)
+		if err != nil {
+			return
+		}
+		if pid <= 0 {
+			t.Fatalf("ParseTarget(%q) = %d, want a positive PID", target, pid)
+		}
+		if got, err := ns.ParseTarget(strconv.Itoa(pid)); err != nil || got != pid {
+			t.Errorf("ParseTarget(%q) = %d, %v; want %d", strconv.Itoa(pid), got, err, pid)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// PinNamespace bind-mounts the nsType namespace of pid onto targetPath,
+// creating the file and its parent directories if needed, so the namespace
+// outlives the process. Enter it later with EnterNamespaceByPath or
+// NewPinnedNamespace.
+func PinNamespace(pid int, nsType string, targetPath string) error {
+	if _, ok := NamespaceTypes[nsType]; !ok {
+		return newNsError("lookup", pid, nsType, ErrUnsupportedNamespace)
+	}
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0o755); err != nil {
+		return newNsError("pin", pid, nsType, err)
+	}
+	// The bind mount needs an existing file to cover.
+	f, err := os.OpenFile(targetPath, os.O_RDONLY|os.O_CREATE, 0)
+	if err != nil {
+		return newNsError("pin", pid, nsType, err)
+	}
+	f.Close()
+
+	if err := unix.Mount(NsPath(pid, nsType), targetPath, "", unix.MS_BIND, ""); err != nil {
+		return newNsError("pin", pid, nsType, fmt.Errorf("bind mount on %s: %w", targetPath, err))
+	}
+	return nil
+}
+
+// UnpinNamespace undoes PinNamespace: it unmounts path and removes the file
+// underneath. The namespace goes away once nothing else refers to it.
+func UnpinNamespace(path string) error {
+	if err := unix.Unmount(path, unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("unpin %s: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unpin %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package ns_test
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// TestPinNamespace pins the network namespace of a process, which then
+// exits. The pin must still be the same namespace, and enterable.
+func TestPinNamespace(t *testing.T) {
+	if asRoot(t) {
+		return
+	}
+	cmd := exec.Command(lookPath(t, "sleep"), "infinity")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot create a network namespace: %v", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	var want unix.Stat_t
+	if err := unix.Stat(ns.NsPath(cmd.Process.Pid, "net"), &want); err != nil {
+		t.Fatal(err)
+	}
+	pin := filepath.Join(t.TempDir(), "pins", "net")
+	err := onLockedThread(func() error {
+		// A mount namespace of the thread's own keeps the pin out of the
+		// test's; it goes away with the thread.
+		if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+			return err
+		}
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+			return err
+		}
+		if err := ns.PinNamespace(cmd.Process.Pid, "net", pin); err != nil {
+			return err
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+
+		var got unix.Stat_t
+		if err := unix.Stat(pin, &got); err != nil {
+			return fmt.Errorf("stat pin after the target exited: %w", err)
+		}
+		if got.Ino != want.Ino {
+			t.Errorf("pin has inode %d after the target exited, want %d", got.Ino, want.Ino)
+		}
+		if err := ns.EnterNamespaceByPath(pin, "net"); err != nil {
+			t.Errorf("entering the pin: %v", err)
+		} else if inode, err := threadInode("net"); err != nil || inode != want.Ino {
+			t.Errorf("thread entered network namespace %d, %v through the pin; want %d", inode, err, want.Ino)
+		}
+		return ns.UnpinNamespace(pin)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// PartialError is returned alongside partial results when some processes
+// could not be inspected. Processes that exited during the scan are not
+// counted as errors.
+type PartialError struct {
+	Errors map[int]error
+}
+
+func (e *PartialError) Error() string {
+	pids := make([]int, 0, len(e.Errors))
+	for pid := range e.Errors {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return fmt.Sprintf("could not inspect %d processes (first: pid %d: %v)", len(pids), pids[0], e.Errors[pids[0]])
+}
+
+// procPids lists the numeric entries of /proc.
+func procPids() ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// ListProcessesInNamespace returns the PIDs of all processes in the
+// namespace at nsPath, which may be a /proc/PID/ns entry or a pinned
+// namespace file. If some processes could not be inspected the PIDs found
+// are returned with a *PartialError.
+func ListProcessesInNamespace(nsPath string) ([]int, error) {
+	nsType, err := nsTypeOf(nsPath)
+	if err != nil {
+		return nil, err
+	}
+	want, err := statNs(nsPath)
+	if err != nil {
+		return nil, err
+	}
+	pids, err := procPids()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []int
+	partial := &PartialError{Errors: map[int]error{}}
+	for _, pid := range pids {
+		id, err := statNs(NsPath(pid, nsType))
+		if err != nil {
+			// The process exited since /proc was listed.
+			if !errors.Is(err, os.ErrNotExist) {
+				partial.Errors[pid] = err
+			}
+			continue
+		}
+		if id == want {
+			matches = append(matches, pid)
+		}
+	}
+	if len(partial.Errors) > 0 {
+		return matches, partial
+	}
+	return matches, nil
+}
+
+// ListAllNamespacedPids groups the PIDs of all processes by the inode of
+// their nsType namespace. Processes that exit during the scan are skipped;
+// if others could not be inspected, the groups found are returned with a
+// *PartialError.
+func ListAllNamespacedPids(nsType string) (map[uint64][]int, error) {
+	if _, ok := NamespaceTypes[nsType]; !ok {
+		return nil, newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+	}
+	pids, err := procPids()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[uint64][]int{}
+	partial := &PartialError{Errors: map[int]error{}}
+	for _, pid := range pids {
+		id, err := statNs(NsPath(pid, nsType))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				partial.Errors[pid] = err
+			}
+			continue
+		}
+		groups[id.ino] = append(groups[id.ino], pid)
+	}
+	if len(partial.Errors) > 0 {
+		return groups, partial
+	}
+	return groups, nil
+}
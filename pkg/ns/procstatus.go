@@ -0,0 +1,121 @@
+package ns
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ProcStatus holds the namespace-related fields of /proc/PID/status. Each
+// NS* field lists the ID in every pid namespace the process is in, starting
+// with the one /proc belongs to and ending with the process's own.
+type ProcStatus struct {
+	NSpid  []int
+	NStgid []int
+	NSpgid []int
+	NSsid  []int
+	// CapEff is the effective capability set, with bit n for capability
+	// n, as it applies in the process's user namespace.
+	CapEff uint64
+}
+
+// ParseProcStatus reads the NS* fields and CapEff of /proc/PID/status. The
+// NS* fields need Linux 4.1 or later; on older kernels the slices are
+// empty. A thread ID reads that thread's status, whose capabilities may
+// differ from the rest of the process's.
+func ParseProcStatus(pid int) (*ProcStatus, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("read status of pid %d: %w", pid, ErrNoProcess)
+		}
+		return nil, fmt.Errorf("read status of pid %d: %w", pid, err)
+	}
+	defer f.Close()
+
+	st := &ProcStatus{}
+	fields := map[string]*[]int{
+		"NSpid":  &st.NSpid,
+		"NStgid": &st.NStgid,
+		"NSpgid": &st.NSpgid,
+		"NSsid":  &st.NSsid,
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && key == "CapEff" {
+			if st.CapEff, err = strconv.ParseUint(strings.TrimSpace(value), 16, 64); err != nil {
+				return nil, fmt.Errorf("parse status of pid %d: %s: %w", pid, key, err)
+			}
+			continue
+		}
+		dst, wanted := fields[key]
+		if !ok || !wanted {
+			continue
+		}
+		for _, field := range strings.Fields(value) {
+			id, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("parse status of pid %d: %s: %w", pid, key, err)
+			}
+			*dst = append(*dst, id)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read status of pid %d: %w", pid, err)
+	}
+	return st, nil
+}
+
+// GetNsPid returns the PID that the process hostPid has inside the pid
+// namespace of the process targetNsPid, both given as seen from here. It
+// fails if hostPid is not in that namespace or one nested below it.
+func GetNsPid(hostPid int, targetNsPid int) (int, error) {
+	host, err := ParseProcStatus(hostPid)
+	if err != nil {
+		return 0, err
+	}
+	target, err := ParseProcStatus(targetNsPid)
+	if err != nil {
+		return 0, err
+	}
+	if len(host.NSpid) == 0 || len(target.NSpid) == 0 {
+		return 0, fmt.Errorf("pid %d: kernel does not report NSpid: %w", hostPid, ErrUnsupportedNamespace)
+	}
+	level := len(target.NSpid) - 1
+	if level >= len(host.NSpid) {
+		return 0, fmt.Errorf("pid %d is not visible in the pid namespace of pid %d", hostPid, targetNsPid)
+	}
+
+	// Being as deep is not enough: walk up from hostPid's namespace to
+	// the target's level and check it is the same namespace.
+	ns, err := os.Open(NsPath(hostPid, "pid"))
+	if err != nil {
+		return 0, newNsError("open", hostPid, "pid", err)
+	}
+	for range len(host.NSpid) - 1 - level {
+		parent, err := nsParent(ns)
+		ns.Close()
+		if err != nil {
+			return 0, err
+		}
+		ns = parent
+	}
+	defer ns.Close()
+	var a, b unix.Stat_t
+	if err := unix.Fstat(int(ns.Fd()), &a); err != nil {
+		return 0, err
+	}
+	if err := unix.Stat(NsPath(targetNsPid, "pid"), &b); err != nil {
+		return 0, newNsError("open", targetNsPid, "pid", err)
+	}
+	if a.Dev != b.Dev || a.Ino != b.Ino {
+		return 0, fmt.Errorf("pid %d is not visible in the pid namespace of pid %d", hostPid, targetNsPid)
+	}
+	return host.NSpid[level], nil
+}
@@ -0,0 +1,120 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a named set of defaults for the nsenter command line.
+type Profile struct {
+	Target     int      `yaml:"target,omitempty"`
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	Command    []string `yaml:"command,omitempty"`
+	Env        []string `yaml:"env,omitempty"`
+}
+
+// DefaultProfilesPath returns nsenter/profiles.yaml under the user's
+// configuration directory, usually ~/.config.
+func DefaultProfilesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "nsenter", "profiles.yaml"), nil
+}
+
+// LoadProfiles reads the profiles in the YAML file at path, a mapping from
+// profile names to profiles. ${VAR} and $VAR in the target, namespaces and
+// env are replaced with the environment's, so a profile can say
+// target: ${CONTAINER_PID}. The command is left alone: a shell in it
+// expands its own variables, inside the namespaces.
+func LoadProfiles(path string) (map[string]Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load profiles: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("load profiles %s: %w", path, err)
+	}
+
+	profiles := map[string]Profile{}
+	if doc.IsZero() {
+		return profiles, nil
+	}
+	if root := doc.Content[0]; root.Kind == yaml.MappingNode {
+		for i := 1; i < len(root.Content); i += 2 {
+			expandProfileEnv(root.Content[i])
+		}
+	}
+	if err := doc.Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("load profiles %s: %w", path, err)
+	}
+	return profiles, nil
+}
+
+// expandProfileEnv expands environment variables in the fields of a
+// profile other than its command.
+func expandProfileEnv(profile *yaml.Node) {
+	if profile.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(profile.Content); i += 2 {
+		if profile.Content[i].Value != "command" {
+			expandEnv(profile.Content[i+1])
+		}
+	}
+}
+
+// expandEnv expands environment variables in the scalars under n. A plain
+// scalar that changed loses its tag, so "${CONTAINER_PID}" can become an int.
+func expandEnv(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode {
+		if expanded := os.ExpandEnv(n.Value); expanded != n.Value {
+			n.Value = expanded
+			if n.Style == 0 {
+				n.Tag = ""
+			}
+		}
+	}
+	for _, child := range n.Content {
+		expandEnv(child)
+	}
+}
+
+// SaveProfile stores p under name in the profiles file at path, creating
+// the file and its directory if needed. Other profiles are kept as they
+// are written, environment references included.
+func SaveProfile(path, name string, p Profile) error {
+	profiles := map[string]yaml.Node{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("save profile %s: %w", name, err)
+	default:
+		if err := yaml.Unmarshal(data, &profiles); err != nil {
+			return fmt.Errorf("save profile %s: %s: %w", name, path, err)
+		}
+	}
+
+	var node yaml.Node
+	if err := node.Encode(p); err != nil {
+		return fmt.Errorf("save profile %s: %w", name, err)
+	}
+	profiles[name] = node
+	if data, err = yaml.Marshal(profiles); err != nil {
+		return fmt.Errorf("save profile %s: %w", name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("save profile %s: %w", name, err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("save profile %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package ns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// RunWithPTY enters the configured namespaces and runs the command on a new
+// pseudo-terminal, relaying it to nsenter's own stdio. Unlike Run the
+// command is always forked. If stdin is a terminal it is put in raw mode
+// until the command exits and the PTY follows its window size.
+func (c *NsenterConfig) RunWithPTY() error {
+	ctx, cancel := c.withTimeout(context.Background())
+	defer cancel()
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if len(c.Unshare) > 0 {
+		return errors.New("Unshare is not supported with a PTY")
+	}
+
+	seccomp, err := c.loadSeccomp()
+	if err != nil {
+		return err
+	}
+
+	cmd := c.command(ctx)
+	var ptmx *os.File
+	err = c.startInNamespaces(ctx, seccomp, func() error {
+		var err error
+		ptmx, err = pty.Start(cmd)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("start %s on pty: %w", c.Command, err)
+	}
+	defer ptmx.Close()
+
+	stdinFd := int(os.Stdin.Fd())
+	if term.IsTerminal(stdinFd) {
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, unix.SIGWINCH)
+		defer signal.Stop(winch)
+		go func() {
+			for range winch {
+				_ = pty.InheritSize(os.Stdin, ptmx)
+			}
+		}()
+		winch <- unix.SIGWINCH
+
+		oldState, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			return fmt.Errorf("set raw terminal mode: %w", err)
+		}
+		defer term.Restore(stdinFd, oldState)
+	}
+
+	go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
+	// Reading the master fails with EIO once the child side is closed.
+	_, _ = io.Copy(os.Stdout, ptmx)
+
+	if err := cmd.Wait(); err != nil {
+		return c.childError(ctx, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package ns
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// RetryPolicy controls how often setns is retried when it fails with
+// EAGAIN, which it can do transiently while the target is itself changing
+// namespaces. Other errors are never retried. Zero fields take the
+// defaults: 3 attempts, starting at 10ms and doubling up to 100ms.
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// withDefaults fills in the zero fields of p.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = 10 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 100 * time.Millisecond
+	}
+	return p
+}
+
+// setnsOptions carries the optional settings of an NsenterConfig down to
+// setnsFd. A nil *setnsOptions means no logging and the default retries.
+type setnsOptions struct {
+	logger *slog.Logger
+	retry  RetryPolicy
+	cache  bool
+	// audit, if set, gets an entry for every setns, naming command.
+	audit   *AuditLogger
+	command []string
+}
+
+func (o *setnsOptions) debug(msg string, args ...any) {
+	if o != nil {
+		logDebug(o.logger, msg, args...)
+	}
+}
+
+func (o *setnsOptions) policy() RetryPolicy {
+	if o == nil {
+		return RetryPolicy{}.withDefaults()
+	}
+	return o.retry.withDefaults()
+}
+
+// setnsRetry calls setns, retrying on EAGAIN as the policy allows. Waiting
+// between attempts stops early with ctx's error if ctx is done.
+func setnsRetry(ctx context.Context, opts *setnsOptions, fd int, nsType string, nsConst int) error {
+	p := opts.policy()
+	delay := p.InitialDelay
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := unix.Setns(fd, nsConst)
+		elapsed := time.Since(start)
+		opts.debug("setns", "fd", fd, "nstype", cloneNames[nsType], "attempt", attempt, "err", err, "elapsed", elapsed)
+		observeSetns(nsType, elapsed, err)
+		if !errors.Is(err, unix.EAGAIN) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay = min(2*delay, p.MaxDelay)
+	}
+}
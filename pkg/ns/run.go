@@ -0,0 +1,45 @@
+package ns
+
+import (
+	"errors"
+	"runtime"
+)
+
+// RunInNamespace runs fn on the calling goroutine's OS thread while that
+// thread is in the given namespaces of pid, then moves the thread back. The
+// namespaces are restored even if fn panics; the panic then continues.
+//
+// If restoring fails, or the mount namespace was entered, the goroutine stays
+// locked to its thread, so that the thread is thrown away when the goroutine
+// exits rather than reused in the wrong namespaces or working directory.
+//
+// File descriptors opened by fn keep referring to the namespaces they were
+// opened in: a socket created in a network namespace still lives there after
+// RunInNamespace returns.
+func RunInNamespace(pid int, nsTypes []string, fn func() error) (err error) {
+	runtime.LockOSThread()
+
+	snap, err := SaveNamespaces(nsTypes)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer snap.Close()
+
+	defer func() {
+		r := recover()
+		if restoreErr := snap.Restore(); restoreErr != nil {
+			err = errors.Join(err, restoreErr)
+		} else if reusable(nsTypes) {
+			runtime.UnlockOSThread()
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	if err := EnterSubset(pid, nsTypes); err != nil {
+		return err
+	}
+	return fn()
+}
@@ -0,0 +1,143 @@
+package ns
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccompProfile is the subset of the OCI seccomp profile format that
+// LoadSeccompProfile understands.
+type seccompProfile struct {
+	DefaultAction   string `json:"defaultAction"`
+	DefaultErrnoRet *uint  `json:"defaultErrnoRet"`
+	Syscalls        []struct {
+		Names    []string          `json:"names"`
+		Action   string            `json:"action"`
+		ErrnoRet *uint             `json:"errnoRet"`
+		Args     []json.RawMessage `json:"args"`
+	} `json:"syscalls"`
+}
+
+// Offsets into struct seccomp_data.
+const (
+	seccompDataNr   = 0
+	seccompDataArch = 4
+)
+
+// x32SyscallBit is __X32_SYSCALL_BIT, set in the number of every x32 call.
+const x32SyscallBit = 0x40000000
+
+// seccompAction translates an OCI action name to a SECCOMP_RET_* value.
+func seccompAction(action string, errnoRet *uint) (uint32, error) {
+	switch action {
+	case "SCMP_ACT_ALLOW":
+		return unix.SECCOMP_RET_ALLOW, nil
+	case "SCMP_ACT_ERRNO":
+		errno := uint32(unix.EPERM)
+		if errnoRet != nil {
+			errno = uint32(*errnoRet)
+		}
+		return unix.SECCOMP_RET_ERRNO | (errno & unix.SECCOMP_RET_DATA), nil
+	case "SCMP_ACT_KILL", "SCMP_ACT_KILL_THREAD":
+		return unix.SECCOMP_RET_KILL_THREAD, nil
+	case "SCMP_ACT_KILL_PROCESS":
+		return unix.SECCOMP_RET_KILL_PROCESS, nil
+	case "SCMP_ACT_LOG":
+		return unix.SECCOMP_RET_LOG, nil
+	}
+	return 0, fmt.Errorf("unsupported seccomp action %q", action)
+}
+
+// LoadSeccompProfile compiles the OCI seccomp profile at path into a BPF
+// program for the running architecture. Only per-syscall rules are
+// supported; rules with argument conditions are rejected, as are syscall
+// names unknown on this architecture.
+func LoadSeccompProfile(path string) (unix.SockFprog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return unix.SockFprog{}, fmt.Errorf("read seccomp profile: %w", err)
+	}
+	var profile seccompProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return unix.SockFprog{}, fmt.Errorf("parse seccomp profile %s: %w", path, err)
+	}
+	if seccompArch == 0 {
+		return unix.SockFprog{}, fmt.Errorf("seccomp profiles are not supported on this architecture")
+	}
+
+	defaultAction, err := seccompAction(profile.DefaultAction, profile.DefaultErrnoRet)
+	if err != nil {
+		return unix.SockFprog{}, fmt.Errorf("seccomp profile %s: %w", path, err)
+	}
+
+	filter := []unix.SockFilter{
+		// Anything not built for our architecture gets killed, since its
+		// syscall numbers mean something else.
+		bpfStmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataArch),
+		bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, seccompArch, 1, 0),
+		bpfStmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		bpfStmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataNr),
+	}
+	if seccompArch == unix.AUDIT_ARCH_X86_64 {
+		// x32 calls share the x86-64 arch and add x32SyscallBit to the
+		// number, so they would slip past every rule to the default.
+		filter = append(filter,
+			bpfJump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit, 0, 1),
+			bpfStmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		)
+	}
+	for _, rule := range profile.Syscalls {
+		if len(rule.Args) > 0 {
+			return unix.SockFprog{}, fmt.Errorf("seccomp profile %s: argument conditions are not supported (%v)", path, rule.Names)
+		}
+		action, err := seccompAction(rule.Action, rule.ErrnoRet)
+		if err != nil {
+			return unix.SockFprog{}, fmt.Errorf("seccomp profile %s: %w", path, err)
+		}
+		for _, name := range rule.Names {
+			nr, ok := syscallNumbers[name]
+			if !ok {
+				return unix.SockFprog{}, fmt.Errorf("seccomp profile %s: unknown syscall %q", path, name)
+			}
+			filter = append(filter,
+				bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, nr, 0, 1),
+				bpfStmt(unix.BPF_RET|unix.BPF_K, action),
+			)
+		}
+	}
+	filter = append(filter, bpfStmt(unix.BPF_RET|unix.BPF_K, defaultAction))
+
+	if len(filter) > unix.BPF_MAXINSNS {
+		return unix.SockFprog{}, fmt.Errorf("seccomp profile %s: filter has %d instructions, limit is %d", path, len(filter), unix.BPF_MAXINSNS)
+	}
+	return unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}, nil
+}
+
+func bpfStmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// installSeccomp applies prog to the calling thread, from where it is
+// inherited by children and kept across execve. Without CAP_SYS_ADMIN the
+// kernel requires no_new_privs, which is set in that case.
+func installSeccomp(prog *unix.SockFprog) error {
+	err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(prog)), 0, 0)
+	if err == unix.EACCES {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set no_new_privs for seccomp: %w", err)
+		}
+		err = unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(prog)), 0, 0)
+	}
+	if err != nil {
+		return fmt.Errorf("install seccomp filter: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build linux && !amd64 && !arm64
+
+package ns
+
+// No syscall table is built in for this architecture, so seccomp profiles
+// cannot be compiled.
+const seccompArch = 0
+
+var syscallNumbers map[string]uint32
@@ -0,0 +1,50 @@
+package ns_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"bustakube.com/nsenter/pkg/ns"
+	"bustakube.com/nsenter/pkg/ns/nstest"
+)
+
+func TestSeccompProfile(t *testing.T) {
+	if asRoot(t) {
+		return
+	}
+	profile := filepath.Join(t.TempDir(), "profile.json")
+	err := os.WriteFile(profile, []byte(`{
+	"defaultAction": "SCMP_ACT_ALLOW",
+	"syscalls": [{"names": ["mkdir", "mkdirat"], "action": "SCMP_ACT_ERRNO"}]
+}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := nstest.NewTestNamespace(t, "uts")
+	dir := filepath.Join(t.TempDir(), "denied")
+
+	c := ns.NewNsenterConfig(n.(*ns.ProcNamespace).Pid, ns.WithUtsNs(), ns.WithCommand(lookPath(t, "mkdir"), dir))
+	c.SeccompProfile = profile
+	out, err := runConfig(t, c)
+	if err == nil {
+		t.Fatalf("mkdir succeeded under the profile:\n%s", out)
+	}
+	// mkdir(1) reports strerror(EPERM).
+	if !strings.Contains(strings.ToLower(out), unix.EPERM.Error()) {
+		t.Errorf("mkdir failed with %v, want EPERM:\n%s", err, out)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s exists after the denied mkdir: %v", dir, err)
+	}
+
+	// Everything else is allowed.
+	c.Command, c.Args = lookPath(t, "true"), nil
+	if out, err := runConfig(t, c); err != nil {
+		t.Errorf("true under the profile: %v\n%s", err, out)
+	}
+}
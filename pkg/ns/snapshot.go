@@ -0,0 +1,80 @@
+package ns
+
+import (
+	"errors"
+	"os"
+	"slices"
+
+	"golang.org/x/sys/unix"
+)
+
+// NsSnapshot holds open references to the namespaces a thread was in, so it
+// can go back to them later.
+type NsSnapshot struct {
+	fds map[string]*os.File
+}
+
+// SaveNamespaces records the calling thread's current namespaces of the
+// given types. It reads /proc/thread-self rather than /proc/self because
+// namespaces are per thread; the caller should hold runtime.LockOSThread
+// from before SaveNamespaces until after Restore. Close releases the
+// snapshot.
+func SaveNamespaces(types []string) (*NsSnapshot, error) {
+	s := &NsSnapshot{fds: make(map[string]*os.File, len(types))}
+	for _, nsType := range types {
+		if _, ok := NamespaceTypes[nsType]; !ok {
+			s.Close()
+			return nil, newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+		}
+		f, err := os.Open("/proc/thread-self/ns/" + nsType)
+		if err != nil {
+			s.Close()
+			return nil, newNsError("save", 0, nsType, err)
+		}
+		s.fds[nsType] = f
+	}
+	return s, nil
+}
+
+// Restore moves the calling thread back into the saved namespaces, in the
+// reverse of the order Run enters them. It tries every type and returns
+// the failures joined. A multithreaded process cannot rejoin a user
+// namespace, and a pid namespace can only be rejoined while it is still an
+// ancestor of the current one.
+func (s *NsSnapshot) Restore() error {
+	return s.restore(enterOrder)
+}
+
+// restore is Restore limited to the given types, which it goes through in
+// reverse order.
+func (s *NsSnapshot) restore(types []string) error {
+	var errs []error
+	for _, nsType := range slices.Backward(types) {
+		f, ok := s.fds[nsType]
+		if !ok {
+			continue
+		}
+		if err := unix.Setns(int(f.Fd()), NamespaceTypes[nsType]); err != nil {
+			errs = append(errs, newNsError("restore", 0, nsType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reusable reports whether a locked thread that entered namespaces of types
+// and came back may be unlocked for other goroutines. Entering a mount
+// namespace unshares the thread's fs state, and coming back leaves its root
+// and working directory at the namespace's rather than the process's, so
+// such a thread is kept locked and thrown away.
+func reusable(types []string) bool {
+	return !slices.Contains(types, "mnt")
+}
+
+// Close releases the saved namespace references.
+func (s *NsSnapshot) Close() error {
+	var errs []error
+	for _, f := range s.fds {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,54 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// RunAsSubreaper runs cmd with the calling process marked as a child
+// subreaper, so descendants of cmd orphaned while it runs are reparented
+// to the caller instead of init. Once cmd has exited, those are waited for
+// until none are left, and the result of cmd.Wait is returned.
+//
+// The kernel only looks for a subreaper among ancestors in the orphan's
+// own pid namespace. Orphans inside a pid namespace the caller is not in go
+// to that namespace's init as usual; this covers commands run in the
+// caller's pid namespace, such as one forked for a timeout. Being a
+// subreaper is a property of the whole process, and the final loop reaps
+// every child of it, including ones started elsewhere in the program.
+func RunAsSubreaper(cmd *exec.Cmd) error {
+	var was int32
+	if err := unix.Prctl(unix.PR_GET_CHILD_SUBREAPER, uintptr(unsafe.Pointer(&was)), 0, 0, 0); err != nil {
+		return fmt.Errorf("get child subreaper: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set child subreaper: %w", err)
+	}
+	defer unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, uintptr(was), 0, 0, 0)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	err := cmd.Wait()
+	reapOrphans()
+	return err
+}
+
+// reapOrphans waits for children until there are none.
+func reapOrphans() {
+	for {
+		var status unix.WaitStatus
+		_, err := unix.Wait4(-1, &status, 0, nil)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			// ECHILD: all reaped.
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package ns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EnterError reports a multi-namespace entry in which some types failed.
+type EnterError struct {
+	Entered []string
+	Failed  map[string]error
+}
+
+func (e *EnterError) Error() string {
+	var failed []string
+	for _, nsType := range enterOrder {
+		if err, ok := e.Failed[nsType]; ok {
+			failed = append(failed, fmt.Sprintf("%s: %v", nsType, err))
+		}
+	}
+	return fmt.Sprintf("entered [%s], failed [%s]", strings.Join(e.Entered, " "), strings.Join(failed, "; "))
+}
+
+// Unwrap returns the individual failures.
+func (e *EnterError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// EnterAll moves the calling thread into every namespace listed under
+// /proc/PID/ns that this package knows, like EnterSubset.
+func EnterAll(pid int) error {
+	types, err := TargetNamespaceTypes(pid)
+	if err != nil {
+		return err
+	}
+	return EnterSubset(pid, types)
+}
+
+// TargetNamespaceTypes returns the namespace types listed under
+// /proc/PID/ns that this package can enter. Listing the directory instead
+// of assuming NamespaceTypes keeps it right on kernels lacking some types.
+func TargetNamespaceTypes(pid int) ([]string, error) {
+	infos, err := ListNamespaces(pid)
+	if err != nil {
+		return nil, err
+	}
+	var types []string
+	for _, info := range infos {
+		if _, ok := NamespaceTypes[info.Type]; ok {
+			types = append(types, info.Type)
+		}
+	}
+	return types, nil
+}
+
+// EnterSubset moves the calling thread into the given namespaces of pid in
+// the order Run uses: user first, pid last. All namespace files are opened
+// before the first setns, so if pid is gone nothing is entered. A failed
+// setns does not stop the remaining types from being tried; the result is
+// then an *EnterError.
+//
+// Entering a pid namespace only affects processes forked afterwards, so the
+// caller must fork to actually run something in it.
+func EnterSubset(pid int, types []string) error {
+	fds, err := OpenNamespaceFds(pid, types)
+	if err != nil {
+		return err
+	}
+	defer closeAll(fds)
+
+	ctx := context.Background()
+	result := &EnterError{Failed: map[string]error{}}
+	for _, nsType := range enterOrder {
+		f, ok := fds[nsType]
+		if !ok {
+			continue
+		}
+		if err := setnsFd(ctx, nil, int(f.Fd()), pid, nsType, NamespaceTypes[nsType]); err != nil {
+			result.Failed[nsType] = err
+			continue
+		}
+		result.Entered = append(result.Entered, nsType)
+	}
+	if len(result.Failed) > 0 {
+		return result
+	}
+	return nil
+}
+
+// EnterSubsetAtomic is EnterSubset that either enters every one of the
+// given namespaces of pid or none: it stops at the first setns that fails
+// and moves the thread back into the namespaces it was in for the types it
+// had already entered. The error then wraps the failure and, joined to it,
+// whatever could not be rolled back. The caller should hold
+// runtime.LockOSThread across the call, and keep it if rolling back failed,
+// so the thread is not reused in a mix of namespaces.
+//
+// Rolling back is best effort, for the reasons given under
+// NsSnapshot.Restore: a multithreaded process cannot rejoin a user
+// namespace it has left.
+func EnterSubsetAtomic(pid int, types []string) error {
+	fds, err := OpenNamespaceFds(pid, types)
+	if err != nil {
+		return err
+	}
+	defer closeAll(fds)
+	snap, err := SaveNamespaces(types)
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+
+	ctx := context.Background()
+	var entered []string
+	for _, nsType := range enterOrder {
+		f, ok := fds[nsType]
+		if !ok {
+			continue
+		}
+		if err := setnsFd(ctx, nil, int(f.Fd()), pid, nsType, NamespaceTypes[nsType]); err != nil {
+			// The failed type is restored too: for mnt, setnsFd has
+			// already unshared a private copy of the mount namespace.
+			return errors.Join(err, snap.restore(append(entered, nsType)))
+		}
+		entered = append(entered, nsType)
+	}
+	return nil
+}
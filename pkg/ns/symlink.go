@@ -0,0 +1,155 @@
+package ns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// ParseNsSymlink splits a namespace symlink target like "net:[4026531992]",
+// as read from /proc/PID/ns/net, into the type and inode.
+func ParseNsSymlink(target string) (nsType string, inode uint64, err error) {
+	nsType, rest, ok := strings.Cut(target, ":[")
+	if !ok || nsType == "" || !strings.HasSuffix(rest, "]") {
+		return "", 0, fmt.Errorf("malformed namespace link %q", target)
+	}
+	inode, err = strconv.ParseUint(strings.TrimSuffix(rest, "]"), 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed namespace link %q", target)
+	}
+	return nsType, inode, nil
+}
+
+// EnterFromSymlink moves the calling thread into the namespace named by a
+// symlink target like "net:[4026531992]". The target only names the
+// namespace, so it is opened through some process found in it under /proc;
+// a namespace that no process is in any more, even if pinned, is not found.
+// The caller is responsible for locking the OS thread.
+func EnterFromSymlink(symlinkTarget string) error {
+	nsType, inode, err := ParseNsSymlink(symlinkTarget)
+	if err != nil {
+		return err
+	}
+	nsConst, ok := NamespaceTypes[nsType]
+	if !ok {
+		return newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+	}
+	if err := checkSupported(0, nsType); err != nil {
+		return err
+	}
+
+	f, pid, err := openNsByInode(nsType, inode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return setnsFd(context.Background(), nil, int(f.Fd()), pid, nsType, nsConst)
+}
+
+// inodeKey identifies a namespace for inodePaths.
+type inodeKey struct {
+	nsType string
+	inode  uint64
+}
+
+// inodePaths caches the /proc/PID/ns path each namespace was last found
+// at, so repeated lookups of the same inode do not scan /proc again. An
+// entry is checked before use and dropped once its process is gone.
+var inodePaths sync.Map // inodeKey -> string
+
+// FindNamespaceByInode returns the /proc/PID/ns/TYPE path of a process in
+// the nsType namespace with the given inode, as found in audit logs or
+// ListNamespaces output. The path is only good while that process lives.
+func FindNamespaceByInode(inode uint64, nsType string) (string, error) {
+	if _, ok := NamespaceTypes[nsType]; !ok {
+		return "", newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+	}
+	key := inodeKey{nsType, inode}
+	if path, ok := inodePaths.Load(key); ok {
+		if link, err := os.Readlink(path.(string)); err == nil && link == fmt.Sprintf("%s:[%d]", nsType, inode) {
+			return path.(string), nil
+		}
+		inodePaths.Delete(key)
+	}
+
+	f, pid, err := openNsByInode(nsType, inode)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	path := NsPath(pid, nsType)
+	inodePaths.Store(key, path)
+	return path, nil
+}
+
+// EnterNamespaceByInode moves the calling thread into the nsType namespace
+// with the given inode, found as by FindNamespaceByInode. The caller is
+// responsible for locking the OS thread.
+func EnterNamespaceByInode(inode uint64, nsType string) error {
+	nsConst, ok := NamespaceTypes[nsType]
+	if !ok {
+		return newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+	}
+	if err := checkSupported(0, nsType); err != nil {
+		return err
+	}
+
+	key := inodeKey{nsType, inode}
+	if path, ok := inodePaths.Load(key); ok {
+		// The process behind a cached path may have exited and its pid
+		// been reused, so check what was opened.
+		if f, err := os.Open(path.(string)); err == nil {
+			var st unix.Stat_t
+			if unix.Fstat(int(f.Fd()), &st) == nil && st.Ino == inode {
+				defer f.Close()
+				return setnsFd(context.Background(), nil, int(f.Fd()), 0, nsType, nsConst)
+			}
+			f.Close()
+		}
+		inodePaths.Delete(key)
+	}
+
+	f, pid, err := openNsByInode(nsType, inode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	inodePaths.Store(key, NsPath(pid, nsType))
+	return setnsFd(context.Background(), nil, int(f.Fd()), pid, nsType, nsConst)
+}
+
+// openNsByInode opens the nsType namespace with the given inode through the
+// first process under /proc that is in it. The open file is checked, so a
+// process that exited or moved in the meantime is skipped.
+func openNsByInode(nsType string, inode uint64) (*os.File, int, error) {
+	pids, err := procPids()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, pid := range pids {
+		path := NsPath(pid, nsType)
+		if link, err := os.Readlink(path); err != nil || link != fmt.Sprintf("%s:[%d]", nsType, inode) {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, 0, newNsError("open", pid, nsType, err)
+		}
+		var st unix.Stat_t
+		if err := unix.Fstat(int(f.Fd()), &st); err != nil || st.Ino != inode {
+			f.Close()
+			continue
+		}
+		return f, pid, nil
+	}
+	return nil, 0, newNsError("find", 0, nsType, fmt.Errorf("no process in namespace %s:[%d]: %w", nsType, inode, ErrNamespaceGone))
+}
@@ -0,0 +1,30 @@
+package ns_test
+
+import (
+	"fmt"
+	"testing"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+func FuzzParseNsSymlink(f *testing.F) {
+	for _, seed := range []string{"net:[4026531992]", "mnt:[18446744073709551615]", "net:[]", ":[1]", "net:[1", "net:[-1]", "net:[007]", "net:[[1]]"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, target string) {
+		nsType, inode, err := ns.ParseNsSymlink(target)
+		if err != nil {
+			return
+		}
+		if nsType == "" {
+			t.Fatalf("ParseNsSymlink(%q) gave an empty type", target)
+		}
+		// What was parsed reads back the same once formatted the way
+		// the kernel does.
+		link := fmt.Sprintf("%s:[%d]", nsType, inode)
+		nsType2, inode2, err := ns.ParseNsSymlink(link)
+		if err != nil || nsType2 != nsType || inode2 != inode {
+			t.Errorf("ParseNsSymlink(%q) = %q, %d, %v; from %q it gave %q, %d", link, nsType2, inode2, err, target, nsType, inode)
+		}
+	})
+}
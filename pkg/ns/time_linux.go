@@ -0,0 +1,7 @@
+//go:build linux
+
+package ns
+
+// cloneNewTime is CLONE_NEWTIME, which older x/sys releases do not define
+// on every architecture.
+const cloneNewTime = 0x80
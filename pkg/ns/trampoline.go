@@ -0,0 +1,255 @@
+package ns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Environment of a re-exec'd trampoline; see NsenterCmd.ReExec.
+const (
+	initEnv  = "_NSENTER_INIT"
+	pidEnv   = "_NSENTER_PID"
+	typesEnv = "_NSENTER_TYPES"
+	pathEnv  = "_NSENTER_PATH"
+	// syncEnv starts the trampoline in a mode that enters nothing: it
+	// waits for fd 3 to reach EOF and then execs, so the parent can set
+	// the child up from outside first. See runUnshared.
+	syncEnv = "_NSENTER_SYNC"
+	// The trampoline of NewNsenterCommand takes a namespace file per type
+	// instead of a pid and types, one "type=path" per line, and may also
+	// be told a directory to change to, credentials to switch to and not
+	// to fork for the pid namespace.
+	nsPathsEnv = "_NSENTER_NSPATHS"
+	dirEnv     = "_NSENTER_DIR"
+	credEnv    = "_NSENTER_CRED"
+	noForkEnv  = "_NSENTER_NOFORK"
+)
+
+// trampolineEnv lists every variable the trampoline consumes.
+var trampolineEnv = []string{initEnv, pidEnv, typesEnv, pathEnv, nsPathsEnv, dirEnv, credEnv, noForkEnv}
+
+// init turns a program that imports this package into the trampoline when
+// NsenterCmd.ReExec started it: it enters the namespaces named in its
+// environment on the main thread, before main runs, and becomes the real
+// command. It never returns in that case.
+func init() {
+	switch {
+	case os.Getenv(initEnv) == "1":
+		os.Exit(trampoline())
+	case os.Getenv(syncEnv) == "1":
+		os.Exit(syncTrampoline())
+	}
+}
+
+// syncTrampoline waits for the parent to close its end of the pipe on fd 3
+// and then execs the command.
+func syncTrampoline() int {
+	path := os.Getenv(pathEnv)
+	os.Unsetenv(syncEnv)
+	os.Unsetenv(pathEnv)
+	pipe := os.NewFile(3, "sync pipe")
+	if ready, _ := io.ReadAll(pipe); len(ready) > 0 {
+		// The parent could not finish setting us up.
+		return 127
+	}
+	pipe.Close()
+	err := unix.Exec(path, os.Args, os.Environ())
+	fmt.Fprintf(os.Stderr, "nsenter trampoline: exec %s: %v\n", path, err)
+	return 127
+}
+
+// trampoline enters the namespaces and execs the command, forking it first
+// if a pid namespace is entered. It returns the exit status on failure, or
+// the command's when it had to fork.
+func trampoline() int {
+	// Never unlocked: main's thread is the one that joins the namespaces.
+	runtime.LockOSThread()
+
+	// Taken before anything is opened here, for the child to get the
+	// same descriptors as an exec'd command would.
+	inherited := inheritedFiles()
+	env := map[string]string{}
+	for _, key := range trampolineEnv {
+		env[key] = os.Getenv(key)
+		os.Unsetenv(key)
+	}
+	path := env[pathEnv]
+	if path == "" {
+		fmt.Fprintf(os.Stderr, "nsenter trampoline: bad environment\n")
+		return 127
+	}
+	types, err := trampolineEnter(env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nsenter trampoline: %v\n", err)
+		return 127
+	}
+	if err := trampolineSetup(env); err != nil {
+		fmt.Fprintf(os.Stderr, "nsenter trampoline: %v\n", err)
+		return 127
+	}
+
+	for _, nsType := range types {
+		if nsType != "pid" || env[noForkEnv] == "1" {
+			continue
+		}
+		// Only children land in the pid namespace, so fork from this
+		// thread and pass on how the command ended.
+		cmd := exec.Command(path, os.Args[1:]...)
+		cmd.Args[0] = os.Args[0]
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		cmd.ExtraFiles = inherited
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return ExitCode(err)
+			}
+			fmt.Fprintf(os.Stderr, "nsenter trampoline: %v\n", err)
+			return 127
+		}
+		return 0
+	}
+
+	err = unix.Exec(path, os.Args, os.Environ())
+	fmt.Fprintf(os.Stderr, "nsenter trampoline: exec %s: %v\n", path, err)
+	return 127
+}
+
+// inheritedFiles returns the descriptors above stderr that were inherited
+// from the parent, such as exec.Cmd.ExtraFiles, in order from 3 with nil
+// for gaps. The Go runtime's own are all close-on-exec.
+func inheritedFiles() []*os.File {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return nil
+	}
+	var files []*os.File
+	for _, e := range entries {
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil || fd < 3 {
+			continue
+		}
+		flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+		if err != nil || flags&unix.FD_CLOEXEC != 0 {
+			continue
+		}
+		for len(files) < fd-3 {
+			files = append(files, nil)
+		}
+		files = append(files, os.NewFile(uintptr(fd), e.Name()))
+	}
+	return files
+}
+
+// trampolineEnter joins the namespaces named in env and returns their
+// types.
+func trampolineEnter(env map[string]string) ([]string, error) {
+	if env[nsPathsEnv] == "" {
+		pid, err := strconv.Atoi(env[pidEnv])
+		if err != nil {
+			return nil, fmt.Errorf("bad environment")
+		}
+		types := strings.Split(env[typesEnv], ",")
+		return types, EnterSubset(pid, types)
+	}
+
+	// Open them all first: once in the target's mount namespace, the
+	// paths may not resolve any more.
+	fds := map[string]*os.File{}
+	defer closeAll(fds)
+	var types []string
+	for _, line := range strings.Split(env[nsPathsEnv], "\n") {
+		nsType, path, ok := strings.Cut(line, "=")
+		if _, known := NamespaceTypes[nsType]; !ok || !known {
+			return nil, fmt.Errorf("bad environment")
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, newNsError("open", 0, nsType, err)
+		}
+		fds[nsType] = f
+		types = append(types, nsType)
+	}
+	for _, nsType := range enterOrder {
+		if f, ok := fds[nsType]; ok {
+			if err := setnsFd(context.Background(), nil, int(f.Fd()), 0, nsType, NamespaceTypes[nsType]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return types, nil
+}
+
+// trampolineSetup applies the directory and credentials in env, in that
+// order, as the new user may not be allowed to change directory.
+func trampolineSetup(env map[string]string) error {
+	if dir := env[dirEnv]; dir != "" {
+		if err := unix.Chdir(dir); err != nil {
+			return fmt.Errorf("change directory to %s: %w", dir, err)
+		}
+	}
+	if env[credEnv] == "" {
+		return nil
+	}
+	var ids []int
+	for _, field := range strings.Split(env[credEnv], ",") {
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return fmt.Errorf("bad environment")
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) < 2 {
+		return fmt.Errorf("bad environment")
+	}
+	// Go applies these to every thread.
+	if err := syscall.Setgroups(ids[2:]); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(ids[1]); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(ids[0]); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	return nil
+}
+
+// startReExec starts the command as the trampoline: the calling program is
+// re-executed with the namespaces to enter in its environment, and its
+// init, above, enters them and execs the command. The namespaces are then
+// joined by a thread that has run nothing but package initialisation, and
+// no thread of the caller has to enter them.
+//
+// The Go runtime has started threads of its own by the time any init runs,
+// so this still cannot join a user namespace; that takes code that runs
+// before the runtime, as runc does with a cgo constructor.
+func (c *NsenterCmd) startReExec() error {
+	if c.pid <= 0 {
+		return fmt.Errorf("re-exec needs the target's pid")
+	}
+	if c.Err != nil {
+		return c.Err
+	}
+	env := c.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	c.Env = append(env,
+		initEnv+"=1",
+		pidEnv+"="+strconv.Itoa(c.pid),
+		typesEnv+"="+strings.Join(c.types, ","),
+		pathEnv+"="+c.Path,
+	)
+	c.Path = "/proc/self/exe"
+	return c.Cmd.Start()
+}
@@ -0,0 +1,94 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NsTree is a process and its descendants, each with its namespaces.
+type NsTree struct {
+	Pid        int               `json:"pid"`
+	Comm       string            `json:"comm"`
+	Namespaces map[string]uint64 `json:"namespaces"`
+	Children   []*NsTree         `json:"children,omitempty"`
+}
+
+// DumpNamespaceTree builds the process tree rooted at rootPid from /proc,
+// recording the namespace inodes of every process. Processes that exit
+// while /proc is scanned are left out.
+func DumpNamespaceTree(rootPid int) (*NsTree, error) {
+	pids, err := procPids()
+	if err != nil {
+		return nil, fmt.Errorf("dump namespace tree: %w", err)
+	}
+	children := map[int][]int{}
+	for _, pid := range pids {
+		ppid, err := readPpid(pid)
+		if err != nil {
+			continue
+		}
+		children[ppid] = append(children[ppid], pid)
+	}
+
+	root, err := treeNode(rootPid, children)
+	if err != nil {
+		return nil, fmt.Errorf("dump namespace tree: %w", err)
+	}
+	return root, nil
+}
+
+func treeNode(pid int, children map[int][]int) (*NsTree, error) {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return nil, err
+	}
+	// Namespaces of processes we may not inspect are left empty.
+	infos, err := ListNamespaces(pid)
+	if err != nil && !errors.Is(err, os.ErrPermission) {
+		return nil, err
+	}
+	node := &NsTree{
+		Pid:        pid,
+		Comm:       strings.TrimSpace(string(comm)),
+		Namespaces: make(map[string]uint64, len(infos)),
+	}
+	for _, info := range infos {
+		node.Namespaces[info.Type] = info.Inode
+	}
+
+	kids := children[pid]
+	sort.Ints(kids)
+	for _, kid := range kids {
+		child, err := treeNode(kid, children)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+// readPpid returns the parent PID from /proc/PID/stat.
+func readPpid(pid int) (int, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// comm may hold spaces and parentheses, so split after the last ')'.
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	return strconv.Atoi(fields[1])
+}
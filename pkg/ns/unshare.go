@@ -0,0 +1,114 @@
+package ns
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFlags ORs together the CLONE_NEW* flags of nsTypes.
+func cloneFlags(nsTypes []string) (uintptr, error) {
+	var flags uintptr
+	for _, nsType := range nsTypes {
+		c, ok := NamespaceTypes[nsType]
+		if !ok {
+			return 0, newNsError("lookup", 0, nsType, ErrUnsupportedNamespace)
+		}
+		flags |= uintptr(c)
+	}
+	return flags, nil
+}
+
+// Unshare moves the calling thread into new namespaces of the given types.
+// As with setns, a new pid namespace only applies to children forked
+// afterwards.
+//
+// The kernel refuses to unshare a user namespace from a multithreaded
+// process, which every Go program is; use NsenterConfig.Unshare to create
+// one for a command instead.
+func Unshare(nsTypes []string) error {
+	for _, nsType := range nsTypes {
+		if nsType == "user" {
+			return newNsError("unshare", 0, nsType, fmt.Errorf("%w: cannot unshare a user namespace from a multithreaded process", ErrUnsupportedNamespace))
+		}
+	}
+	flags, err := cloneFlags(nsTypes)
+	if err != nil {
+		return err
+	}
+	if err := unix.Unshare(int(flags)); err != nil {
+		return fmt.Errorf("unshare %v: %w", nsTypes, err)
+	}
+	return nil
+}
+
+// runUnshared forks the command into new namespaces of the types in
+// c.Unshare. For root, a new user namespace maps its UID and GID to
+// themselves. For anyone else the namespace is set up the rootless way, by
+// ConfigureUserNamespaceRootless, which has to run from outside once the
+// child exists; the child is then the sync trampoline, which waits for it
+// before exec'ing the command. Dir is applied in the new namespaces; the
+// other settings that need nsenter's own thread to set the command up are
+// rejected by Validate.
+func (c *NsenterConfig) runUnshared(ctx context.Context) error {
+	flags, err := cloneFlags(c.Unshare)
+	if err != nil {
+		return err
+	}
+
+	cmd := c.command(ctx)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = c.Dir
+	// The child unshares the mount namespace itself rather than getting
+	// it from clone, so that Go makes its mounts MS_REC|MS_PRIVATE first,
+	// as unshare(1) does: otherwise mounts made in it reach the host.
+	cmd.SysProcAttr.Cloneflags = flags &^ unix.CLONE_NEWNS
+	cmd.SysProcAttr.Unshareflags = flags & unix.CLONE_NEWNS
+	rootless := flags&unix.CLONE_NEWUSER != 0 && os.Geteuid() != 0
+	var ready *os.File
+	switch {
+	case rootless:
+		if cmd.Err != nil {
+			return cmd.Err
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		defer w.Close()
+		ready = w
+		cmd.ExtraFiles = []*os.File{r}
+		cmd.Env = append(cmd.Env, syncEnv+"=1", pathEnv+"="+cmd.Path)
+		cmd.Path = "/proc/self/exe"
+	case flags&unix.CLONE_NEWUSER != 0:
+		uid, gid := os.Getuid(), os.Getgid()
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+	}
+
+	ch := newChild(cmd)
+	if err := cmd.Start(); err != nil {
+		ch.stop()
+		return fmt.Errorf("start %s: %w", c.Command, err)
+	}
+	if rootless {
+		if err := ConfigureUserNamespaceRootless(cmd.Process.Pid); err != nil {
+			// Anything written tells the trampoline to give up.
+			ready.Write([]byte{1})
+			ready.Close()
+			ch.wait()
+			return err
+		}
+		ready.Close()
+	}
+	if err := ch.wait(); err != nil {
+		return c.childError(ctx, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package ns_test
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// TestUnshareRootless unshares a user and a uts namespace without root.
+// Run as root, the helper process drops to nobody for it. The command must
+// be root in the new user namespace, and able to set the hostname of the
+// new uts namespace without changing the test's.
+func TestUnshareRootless(t *testing.T) {
+	c := &ns.NsenterConfig{
+		Unshare: []string{"user", "uts"},
+		Command: lookPath(t, "sh"),
+		Args:    []string{"-c", "id -u && hostname unshared && hostname && readlink /proc/self/ns/uts"},
+	}
+	cmd := helperCommand(t, c)
+	// nobody may not be able to reach the test's directory.
+	cmd.Dir = "/"
+	if os.Geteuid() == 0 {
+		cmd.Path = copyExecutable(t, os.Args[0], sharedTempDir(t), 0o755)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534}}
+	}
+	probe := exec.Command(cmd.Path)
+	probe.Env = append(os.Environ(), helperEnv+"=userns")
+	probe.Dir, probe.SysProcAttr = cmd.Dir, cmd.SysProcAttr
+	if out, err := probe.CombinedOutput(); err != nil {
+		t.Skipf("unprivileged user namespaces are not available: %v\n%s", err, out)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownUts, err := os.Readlink("/proc/self/ns/uts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "newuidmap") || strings.Contains(string(out), "newgidmap") {
+			t.Skipf("newuidmap or newgidmap is not usable here: %s", out)
+		}
+		t.Fatalf("%v\n%s", err, out)
+	}
+	got := strings.Fields(string(out))
+	if len(got) != 3 || got[0] != "0" || got[1] != "unshared" || got[2] == ownUts {
+		t.Errorf("got uid, hostname and uts namespace %q; want 0, unshared and not the test's %s", got, ownUts)
+	}
+	if now, err := os.Hostname(); err != nil || now != hostname {
+		t.Errorf("the test's hostname is now %q, %v; want %q", now, err, hostname)
+	}
+}
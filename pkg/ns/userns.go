@@ -0,0 +1,236 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// UidMapping maps Size IDs starting at HostID outside a user namespace to
+// IDs starting at ContainerID inside it.
+type UidMapping struct {
+	ContainerID uint32
+	HostID      uint32
+	Size        uint32
+}
+
+// GidMapping is the group ID counterpart of UidMapping.
+type GidMapping = UidMapping
+
+// IdMapping is a line of uid_map or gid_map as read back by ReadUidMap and
+// ReadGidMap.
+type IdMapping = UidMapping
+
+// ParseIdMapping parses a mapping written as container:host:size.
+func ParseIdMapping(s string) (UidMapping, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return UidMapping{}, fmt.Errorf("id mapping %q: want container:host:size", s)
+	}
+	var ids [3]uint32
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return UidMapping{}, fmt.Errorf("id mapping %q: %w", s, err)
+		}
+		ids[i] = uint32(n)
+	}
+	return UidMapping{ContainerID: ids[0], HostID: ids[1], Size: ids[2]}, nil
+}
+
+// WriteUidMap writes the uid_map of pid's user namespace. The kernel only
+// accepts a single write per namespace.
+func WriteUidMap(pid int, mappings []UidMapping) error {
+	return writeIdMap(fmt.Sprintf("/proc/%d/uid_map", pid), mappings)
+}
+
+// WriteGidMap writes the gid_map of pid's user namespace. Unprivileged
+// callers must call SetgroupsDeny first.
+func WriteGidMap(pid int, mappings []GidMapping) error {
+	return writeIdMap(fmt.Sprintf("/proc/%d/gid_map", pid), mappings)
+}
+
+// ReadUidMap returns the uid mappings of pid's user namespace, as seen
+// from the caller's. It is empty for a namespace not mapped yet; the
+// initial namespace reads as the single identity mapping 0 0 4294967295.
+func ReadUidMap(pid int) ([]IdMapping, error) {
+	return readIdMap(fmt.Sprintf("/proc/%d/uid_map", pid))
+}
+
+// ReadGidMap returns the gid mappings of pid's user namespace, like
+// ReadUidMap.
+func ReadGidMap(pid int) ([]IdMapping, error) {
+	return readIdMap(fmt.Sprintf("/proc/%d/gid_map", pid))
+}
+
+// ReadUserNsOwner returns the uid that created pid's user namespace, which
+// holds every capability over it from the parent namespace, so a process
+// of that uid there can enter it without being root. The kernel reports
+// it through the NS_GET_OWNER_UID ioctl, as a uid of the caller's user
+// namespace; the nsfs file itself is always owned by root.
+func ReadUserNsOwner(pid int) (uid int, err error) {
+	f, err := os.Open(NsPath(pid, "user"))
+	if err != nil {
+		return 0, newNsError("open", pid, "user", err)
+	}
+	defer f.Close()
+	owner, err := unix.IoctlGetUint32(int(f.Fd()), nsGetOwnerUid)
+	if err != nil {
+		return 0, newNsError("owner of", pid, "user", err)
+	}
+	return int(owner), nil
+}
+
+func readIdMap(path string) ([]IdMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("read %s: %w", path, ErrNoProcess)
+		}
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var mappings []IdMapping
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("read %s: malformed line %q", path, line)
+		}
+		var ids [3]uint32
+		for i, field := range fields {
+			n, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", path, err)
+			}
+			ids[i] = uint32(n)
+		}
+		mappings = append(mappings, IdMapping{ContainerID: ids[0], HostID: ids[1], Size: ids[2]})
+	}
+	return mappings, nil
+}
+
+// SetgroupsDeny disables setgroups(2) in pid's user namespace, which the
+// kernel requires before an unprivileged process may write gid_map.
+func SetgroupsDeny(pid int) error {
+	path := fmt.Sprintf("/proc/%d/setgroups", pid)
+	if err := os.WriteFile(path, []byte("deny"), 0); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeIdMap(path string, mappings []UidMapping) error {
+	var b strings.Builder
+	for _, m := range mappings {
+		fmt.Fprintf(&b, "%d %d %d\n", m.ContainerID, m.HostID, m.Size)
+	}
+	// The whole map must arrive in one write(2).
+	if err := os.WriteFile(path, []byte(b.String()), 0); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// ConfigureUserNamespaceRootless writes the uid and gid maps of the new
+// user namespace of childPid for an unprivileged caller, making the caller
+// root inside. When the setuid newuidmap and newgidmap helpers are in PATH,
+// the caller's ranges in /etc/subuid and /etc/subgid are mapped as well,
+// from ID 1 up, so the namespace has as many users as a container needs.
+// Without the helpers, or without ranges, only the caller's own uid and
+// gid are mapped, which the kernel lets anyone write directly.
+func ConfigureUserNamespaceRootless(childPid int) error {
+	uid, gid := os.Getuid(), os.Getgid()
+	name := ""
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		name = u.Username
+	}
+	subUids, err := readSubIDs("/etc/subuid", name, uid)
+	if err != nil {
+		return err
+	}
+	subGids, err := readSubIDs("/etc/subgid", name, uid)
+	if err != nil {
+		return err
+	}
+
+	uidMap := []UidMapping{{ContainerID: 0, HostID: uint32(uid), Size: 1}}
+	gidMap := []GidMapping{{ContainerID: 0, HostID: uint32(gid), Size: 1}}
+	newuidmap, uidErr := exec.LookPath("newuidmap")
+	newgidmap, gidErr := exec.LookPath("newgidmap")
+	if uidErr != nil || gidErr != nil || len(subUids) == 0 || len(subGids) == 0 {
+		if err := WriteUidMap(childPid, uidMap); err != nil {
+			return err
+		}
+		if err := SetgroupsDeny(childPid); err != nil {
+			return err
+		}
+		return WriteGidMap(childPid, gidMap)
+	}
+
+	if err := runIdMapHelper(newuidmap, childPid, append(uidMap, stackSubIDs(subUids)...)); err != nil {
+		return err
+	}
+	return runIdMapHelper(newgidmap, childPid, append(gidMap, stackSubIDs(subGids)...))
+}
+
+// readSubIDs returns the ranges /etc/subuid or /etc/subgid at path lists
+// for the user called name or with the given uid, as host IDs and sizes. A
+// missing file lists none.
+func readSubIDs(path, name string, uid int) ([]UidMapping, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var ranges []UidMapping
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 3 || (fields[0] != name && fields[0] != strconv.Itoa(uid)) {
+			continue
+		}
+		start, err1 := strconv.ParseUint(fields[1], 10, 32)
+		count, err2 := strconv.ParseUint(fields[2], 10, 32)
+		if err1 != nil || err2 != nil || count == 0 {
+			return nil, fmt.Errorf("%s: malformed line %q", path, line)
+		}
+		ranges = append(ranges, UidMapping{HostID: uint32(start), Size: uint32(count)})
+	}
+	return ranges, nil
+}
+
+// stackSubIDs places subordinate ranges one after another inside the
+// namespace, starting at ID 1 just after the caller's root.
+func stackSubIDs(ranges []UidMapping) []UidMapping {
+	next := uint32(1)
+	mappings := make([]UidMapping, 0, len(ranges))
+	for _, r := range ranges {
+		mappings = append(mappings, UidMapping{ContainerID: next, HostID: r.HostID, Size: r.Size})
+		next += r.Size
+	}
+	return mappings
+}
+
+// runIdMapHelper runs newuidmap or newgidmap, which take the mappings as
+// flat container host size triples after the PID.
+func runIdMapHelper(helper string, pid int, mappings []UidMapping) error {
+	args := []string{strconv.Itoa(pid)}
+	for _, m := range mappings {
+		args = append(args, strconv.FormatUint(uint64(m.ContainerID), 10), strconv.FormatUint(uint64(m.HostID), 10), strconv.FormatUint(uint64(m.Size), 10))
+	}
+	if out, err := exec.Command(helper, args...).CombinedOutput(); err != nil {
+		// %v, not %w: the helper exiting non-zero is not the command doing so.
+		return fmt.Errorf("%s %s: %v: %s", filepath.Base(helper), strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
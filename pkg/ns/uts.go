@@ -0,0 +1,61 @@
+package ns
+
+import "golang.org/x/sys/unix"
+
+// ReadHostname returns the hostname of pid's uts namespace. The calling
+// goroutine's thread joins the namespace just long enough to call uname(2)
+// and is then moved back, as by Namespace.Do.
+//
+// There is no /proc/PID file to read it from instead:
+// /proc/sys/kernel/hostname shows the uts namespace of the reader, even
+// when reached through /proc/PID/root.
+func ReadHostname(pid int) (string, error) {
+	uts, err := readUname(pid)
+	if err != nil {
+		return "", err
+	}
+	return unix.ByteSliceToString(uts.Nodename[:]), nil
+}
+
+// ReadDomainname returns the NIS domain name of pid's uts namespace, like
+// ReadHostname.
+func ReadDomainname(pid int) (string, error) {
+	uts, err := readUname(pid)
+	if err != nil {
+		return "", err
+	}
+	return unix.ByteSliceToString(uts.Domainname[:]), nil
+}
+
+// SetHostname sets the hostname of pid's uts namespace, which takes
+// CAP_SYS_ADMIN over it. Every process in the namespace sees the change.
+func SetHostname(pid int, hostname string) error {
+	n, err := NewProcNamespace(pid, "uts")
+	if err != nil {
+		return err
+	}
+	return n.Do(func() error {
+		if err := unix.Sethostname([]byte(hostname)); err != nil {
+			return newNsError("set hostname in", pid, "uts", err)
+		}
+		return nil
+	})
+}
+
+func readUname(pid int) (*unix.Utsname, error) {
+	n, err := NewProcNamespace(pid, "uts")
+	if err != nil {
+		return nil, err
+	}
+	var uts unix.Utsname
+	err = n.Do(func() error {
+		if err := unix.Uname(&uts); err != nil {
+			return newNsError("uname in", pid, "uts", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &uts, nil
+}
@@ -0,0 +1,101 @@
+package ns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ConfigWarning is a finding of Validate that does not stop Run: a
+// combination that works but probably not the way it was meant to.
+type ConfigWarning struct {
+	Msg string
+}
+
+func (w *ConfigWarning) Error() string {
+	return w.Msg
+}
+
+// Validate checks c for conflicting or impossible combinations of options
+// and returns everything it finds, not just the first. Warnings come in the
+// same slice as *ConfigWarning values, which callers pick out with
+// errors.As; Run refuses to start on any other error, but goes ahead
+// despite warnings and leaves it to the caller to mention them.
+func (c *NsenterConfig) Validate() []error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	warn := func(format string, args ...any) {
+		errs = append(errs, &ConfigWarning{Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Command == "" {
+		fail("no command given")
+	}
+	if len(c.Unshare) > 0 && (c.Pid > 0 || len(c.Namespaces) > 0) {
+		fail("Unshare cannot be combined with entering a target's namespaces")
+	}
+	for _, nsType := range append(append([]string{}, c.Namespaces...), c.Unshare...) {
+		if _, ok := NamespaceTypes[nsType]; !ok {
+			errs = append(errs, newNsError("lookup", c.Pid, nsType, ErrUnsupportedNamespace))
+		}
+	}
+	for _, nsType := range c.Namespaces {
+		if _, ok := c.NsPaths[nsType]; !ok && c.nsPid(nsType) <= 0 {
+			fail("no target process or path for %s namespace", nsType)
+		}
+	}
+	if c.Dir != "" && c.TargetDir {
+		fail("Dir and TargetDir are mutually exclusive")
+	}
+	if c.PivotRoot != "" && c.TargetDir {
+		fail("PivotRoot and TargetDir are mutually exclusive")
+	}
+	if len(c.Unshare) > 0 && (c.SeccompProfile != "" || c.NoNewPrivs || c.Chroot != "" || c.PivotRoot != "" || c.RemountSys || c.TargetDir) {
+		fail("Unshare cannot be combined with SeccompProfile, NoNewPrivs, Chroot, PivotRoot, RemountSys or TargetDir")
+	}
+	if c.NoFork && (c.Timeout > 0 || c.Setsid) {
+		fail("NoFork cannot be combined with Timeout or Setsid, which need a child")
+	}
+	if c.Chroot != "" && (c.TargetDir || c.PivotRoot != "") {
+		fail("Chroot cannot be combined with TargetDir or PivotRoot")
+	}
+
+	// Joining any namespace but a user namespace needs CAP_SYS_ADMIN over
+	// it; without root, that normally comes from joining its owner first.
+	if os.Geteuid() != 0 && len(c.Namespaces) > 0 && !c.has("user") {
+		if eff, err := effectiveCaps(); err == nil && eff&(1<<capSysAdmin) == 0 {
+			fail("entering %v without root or CAP_SYS_ADMIN needs the user namespace too", c.Namespaces)
+		}
+	}
+
+	if c.has("pid") && !c.has("mnt") {
+		warn("pid namespace entered without the mount namespace: ps and other readers of /proc still see nsenter's pid namespace")
+	}
+	for _, nsType := range c.Unshare {
+		if nsType == "pid" {
+			warn("new pid namespace: /proc still shows the parent pid namespace until the command mounts a new one")
+		}
+	}
+	if c.RemountSys && !c.has("net") && !c.has("cgroup") {
+		warn("RemountSys without the network or cgroup namespace: the new /sys shows nsenter's own")
+	}
+	if c.Chroot != "" && !c.has("mnt") {
+		warn("Chroot without the mount namespace: %s is taken from nsenter's own filesystem", c.Chroot)
+	}
+	return errs
+}
+
+// validate runs Validate and returns the errors other than warnings, if
+// any, joined.
+func (c *NsenterConfig) validate() error {
+	var errs []error
+	for _, err := range c.Validate() {
+		var warning *ConfigWarning
+		if !errors.As(err, &warning) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,35 @@
+package ns_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"bustakube.com/nsenter/pkg/ns"
+)
+
+// TestValidateWarnings checks that Validate returns warnings among its
+// errors as *ConfigWarning values, apart from real errors.
+func TestValidateWarnings(t *testing.T) {
+	c := ns.NewNsenterConfig(os.Getpid(), ns.WithUserNs(), ns.WithPidNs(), ns.WithCommand("/bin/true"))
+	var warnings, errs []error
+	for _, err := range c.Validate() {
+		var warning *ns.ConfigWarning
+		if errors.As(err, &warning) {
+			warnings = append(warnings, err)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		t.Errorf("Validate() errors = %v, want none", errs)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("Validate() warnings = %v, want the one for pid without mnt", warnings)
+	}
+
+	c.Command = ""
+	if errs := c.Validate(); len(errs) != 2 {
+		t.Errorf("Validate() without a command = %v, want the warning and an error", errs)
+	}
+}
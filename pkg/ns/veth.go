@@ -0,0 +1,112 @@
+package ns
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// CreateVethPair creates a veth pair with veth1Name in ns1 and veth2Name in
+// ns2. Both ends are left down and without addresses.
+func CreateVethPair(ns1, ns2 Namespace, veth1Name, veth2Name string) error {
+	target, err := os.Open(ns2.Path())
+	if err != nil {
+		return fmt.Errorf("create veth pair: %w", err)
+	}
+	defer target.Close()
+
+	return ns1.Do(func() error {
+		c, err := openNetlink()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		peer := concat(ifInfomsg(0, 0, 0), nlAttr(unix.IFLA_IFNAME, nlString(veth2Name)))
+		linkInfo := concat(
+			nlAttr(unix.IFLA_INFO_KIND, nlString("veth")),
+			nlAttr(unix.IFLA_INFO_DATA, nlAttr(vethInfoPeer, peer)),
+		)
+		msg := concat(ifInfomsg(0, 0, 0), nlAttr(unix.IFLA_IFNAME, nlString(veth1Name)), nlAttr(unix.IFLA_LINKINFO, linkInfo))
+		if _, err := c.request(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL, msg); err != nil {
+			return fmt.Errorf("create veth pair %s/%s: %w", veth1Name, veth2Name, err)
+		}
+
+		index, err := c.linkIndex(veth2Name)
+		if err != nil {
+			return err
+		}
+		if err := c.setLinkNs(index, int(target.Fd())); err != nil {
+			return fmt.Errorf("move %s to %s: %w", veth2Name, ns2.Path(), err)
+		}
+		return nil
+	})
+}
+
+// ConnectNamespaces links the network namespaces of pid1 and pid2 with a
+// veth pair, assigns each end an address from a link-local /30 picked from
+// the two PIDs, and brings both ends up. It returns the addresses on the
+// pid1 and pid2 sides.
+func ConnectNamespaces(pid1, pid2 int) (net.IPNet, net.IPNet, error) {
+	ns1, err := NewProcNamespace(pid1, "net")
+	if err != nil {
+		return net.IPNet{}, net.IPNet{}, err
+	}
+	ns2, err := NewProcNamespace(pid2, "net")
+	if err != nil {
+		return net.IPNet{}, net.IPNet{}, err
+	}
+
+	// Each end is named after the process on the other side.
+	veth1, veth2 := fmt.Sprintf("ve%d", pid2), fmt.Sprintf("ve%d", pid1)
+	if err := CreateVethPair(ns1, ns2, veth1, veth2); err != nil {
+		return net.IPNet{}, net.IPNet{}, err
+	}
+
+	addr1, addr2 := vethAddrs(pid1, pid2)
+	for _, end := range []struct {
+		ns   Namespace
+		name string
+		addr net.IPNet
+	}{{ns1, veth1, addr1}, {ns2, veth2, addr2}} {
+		err := end.ns.Do(func() error {
+			c, err := openNetlink()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			index, err := c.linkIndex(end.name)
+			if err != nil {
+				return err
+			}
+			if err := c.addAddr(index, end.addr); err != nil {
+				return fmt.Errorf("add %s to %s: %w", end.addr.String(), end.name, err)
+			}
+			if err := c.setLinkUp(index); err != nil {
+				return fmt.Errorf("bring up %s: %w", end.name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return net.IPNet{}, net.IPNet{}, err
+		}
+	}
+	return addr1, addr2, nil
+}
+
+// vethAddrs picks the two usable addresses of a /30 in 169.254.0.0/16 from
+// the PIDs, so different pairs are unlikely to collide.
+func vethAddrs(pid1, pid2 int) (net.IPNet, net.IPNet) {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d-%d", pid1, pid2)
+	block := h.Sum32() % (1 << 14)
+	base := 0xa9fe0000 | block<<2
+	mask := net.CIDRMask(30, 32)
+	ip := func(v uint32) net.IP {
+		return net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v)).To4()
+	}
+	return net.IPNet{IP: ip(base + 1), Mask: mask}, net.IPNet{IP: ip(base + 2), Mask: mask}
+}
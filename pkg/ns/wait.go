@@ -0,0 +1,50 @@
+package ns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// WaitInterval is how often WaitForPid and WaitForNamespace look again.
+var WaitInterval = 10 * time.Millisecond
+
+// WaitForPid waits until /proc/PID/ns/mnt of pid can be opened, or ctx is
+// done. It covers the window right after a process is started in which
+// its /proc entries do not exist yet; errors other than a missing file,
+// such as EACCES, are returned at once.
+func WaitForPid(ctx context.Context, pid int) error {
+	f, err := WaitForNamespace(ctx, pid, "mnt")
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// WaitForNamespace is like WaitForPid for the nsType namespace and returns
+// the opened namespace file, which the caller closes.
+func WaitForNamespace(ctx context.Context, pid int, nsType string) (*os.File, error) {
+	if _, ok := NamespaceTypes[nsType]; !ok {
+		return nil, newNsError("lookup", pid, nsType, ErrUnsupportedNamespace)
+	}
+	path := fmt.Sprintf("/proc/%d/ns/%s", pid, nsType)
+
+	ticker := time.NewTicker(WaitInterval)
+	defer ticker.Stop()
+	for {
+		f, err := os.Open(path)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, newNsError("open", pid, nsType, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, newNsError("wait for", pid, nsType, fmt.Errorf("%w: %w", ctx.Err(), ErrNoProcess))
+		case <-ticker.C:
+		}
+	}
+}